@@ -0,0 +1,286 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+	"sync"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// CHUNKS_CONCURRENCY is the max number of chunks SendChunked()
+	// and CostChunked() process at the same time.
+	CHUNKS_CONCURRENCY = 4
+)
+
+// SendChunked splits the recipients of req (and their personalized messages)
+// into the chunks of up to chunkSize recipients, sends each chunk by its own call
+// of send, processing up to CHUNKS_CONCURRENCY chunks at the same time,
+// and merges the responses in the original order of recipients.
+// Use it for providers that limit the number of recipients per request.
+//
+// If sending a chunk fails, its recipients get ERROR_CODE_NOT_SENT error code
+// and the cause in their results, the chunks that have been sent are kept
+// and the response is returned along with an error of PartialFailure class.
+// Only an error is returned if all chunks fail.
+func SendChunked(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+	chunkSize int,
+	send SendFunc,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to send a message(s) by chunks."
+
+	recipients := req.AllRecipients()
+	switch {
+
+	case send == nil:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Send function is nil.").
+			Throw()
+
+	case chunkSize <= 0:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Chunk size must be positive.").
+			WithInt("chunk_size", chunkSize).
+			Throw()
+
+	case len(recipients) <= chunkSize:
+		return send(ctx, req)
+	}
+
+	chunks := chunksOf(len(recipients), chunkSize)
+	subReqs := make([]*SendMessageRequest, len(chunks))
+	for i, chunk := range chunks {
+		subReqs[i] = subRequest(req, recipients, chunk)
+	}
+
+	sendOf := func(int) SendFunc { return send }
+	if resp, err = sendParallel(ctx, len(recipients), chunks, subReqs, CHUNKS_CONCURRENCY, sendOf, nil); err.IsNotNil() {
+		return resp, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// CostChunked is the same as SendChunked() but for Cost().
+// Costs (Segments) of the merged response are nil if at least one chunk has no them.
+// Unlike SendChunked(), an error is returned if any chunk fails.
+func CostChunked(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+	chunkSize int,
+	cost CostFunc,
+) (
+	resp *CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to get an info about cost of sending a message(s) by chunks."
+
+	recipients := req.AllRecipients()
+	switch {
+
+	case cost == nil:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Cost function is nil.").
+			Throw()
+
+	case chunkSize <= 0:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Chunk size must be positive.").
+			WithInt("chunk_size", chunkSize).
+			Throw()
+
+	case len(recipients) <= chunkSize:
+		return cost(ctx, req)
+	}
+
+	chunks := chunksOf(len(recipients), chunkSize)
+	subResps := make([]*CostSendMessageResponse, len(chunks))
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr *ekaerr.Error
+	)
+
+	sem := make(chan struct{}, CHUNKS_CONCURRENCY)
+
+	for i, chunk := range chunks {
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, subReq *SendMessageRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			subResp, err := cost(ctx, subReq)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err.IsNotNil() {
+				if firstErr.IsNil() {
+					firstErr = err.WithInt("chunk_index", i)
+				}
+				return
+			}
+
+			subResps[i] = subResp
+		}(i, subRequest(req, recipients, chunk))
+	}
+
+	wg.Wait()
+
+	if firstErr.IsNotNil() {
+		return nil, firstErr.
+			AddMessage(s).
+			Throw()
+	}
+
+	resp = newCostResponse(len(recipients))
+	for i, chunk := range chunks {
+		mergeCostResponse(resp, subResps[i], chunk)
+	}
+
+	return resp, nil
+}
+
+// sendParallel sends each of subReqs by sendOf(i), processing up to concurrency
+// of them at the same time, and merges their responses to the response
+// for n recipients. indexes[i] are the indexes of recipients subReqs[i] is sent to.
+//
+// If composeID is not nil, subReqs are sent by different Senders: the IDs
+// of subReqs[i] are composed by composeID(i, id), and the balance
+// is reset by resetMergedBalance().
+//
+// Recipients of failed requests get ERROR_CODE_NOT_SENT error code
+// and the cause in their results (see failSendResponse()).
+// If all requests fail, only the error is returned. If some of them fail,
+// the response is returned along with an error of PartialFailure class.
+func sendParallel(
+
+	ctx context.Context,
+	n int,
+	indexes [][]int,
+	subReqs []*SendMessageRequest,
+	concurrency int,
+	sendOf func(i int) SendFunc,
+	composeID func(i int, id string) string,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to send a message(s) in parallel."
+
+	resp = newSendResponse(n)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr *ekaerr.Error
+		nOK      int
+		nFailed  int
+	)
+
+	sem := make(chan struct{}, concurrency)
+
+	for i, subReq := range subReqs {
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, group []int, subReq *SendMessageRequest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			subResp, err := sendOf(i)(ctx, subReq)
+
+			if err.IsNil() && !isSendResponseValid(subResp, len(group)) {
+				err = ekaerr.IllegalState.New(s).
+					WithString("description", "Sender's response violates the IDs, ErrorCodes length contract.").
+					Throw()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err.IsNotNil() {
+				if firstErr.IsNil() {
+					firstErr = err.WithInt("recipient_index", group[0])
+				}
+				if !isPartialFailure(subResp, err, len(group)) {
+					nFailed += len(group)
+					failSendResponse(resp, subReq.AllRecipients(), group, err)
+					return
+				}
+			}
+
+			var composeGroupID func(id string) string
+			if composeID != nil {
+				composeGroupID = func(id string) string {
+					return composeID(i, id)
+				}
+			}
+
+			nOK++
+			mergeSendResponse(resp, subResp, group, composeGroupID)
+		}(i, indexes[i], subReq)
+	}
+
+	wg.Wait()
+
+	if composeID != nil {
+		resetMergedBalance(resp, nOK)
+	}
+
+	switch {
+	case nOK == 0:
+		return nil, firstErr.
+			Throw()
+
+	case firstErr.IsNotNil():
+		return resp, PartialFailure.New(s).
+			WithString("description", "Message has not been sent to some recipients.").
+			WithInt("failed_recipients", nFailed).
+			WithString("cause_class", firstErr.Class().FullName()).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// chunksOf splits the indexes [0..n) into the chunks of up to size indexes.
+func chunksOf(n, size int) [][]int {
+	chunks := make([][]int, 0, (n+size-1)/size)
+	for from := 0; from < n; from += size {
+		to := from + size
+		if to > n {
+			to = n
+		}
+		chunk := make([]int, to-from)
+		for i := range chunk {
+			chunk[i] = from + i
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
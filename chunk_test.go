@@ -0,0 +1,96 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestSendChunked(t *testing.T) {
+	q := smsenderu_mock.New()
+
+	recipients := make([]string, 25)
+	messages := make([]string, 25)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("790000000%02d", i)
+		messages[i] = fmt.Sprintf("Hello, #%d", i)
+	}
+
+	var calls, inFlight, maxInFlight int32
+	send := func(ctx context.Context, req *smsenderu.SendMessageRequest) (*smsenderu.SendMessageResponse, *ekaerr.Error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			prev := atomic.LoadInt32(&maxInFlight)
+			if n <= prev || atomic.CompareAndSwapInt32(&maxInFlight, prev, n) {
+				break
+			}
+		}
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return nil, smsenderu.ProviderUnavailable.New("Chunk is failed.").Throw()
+		}
+		if len(req.Recipients) > 10 {
+			return nil, ekaerr.IllegalArgument.New("Chunk is too large.").Throw()
+		}
+		return q.Send(ctx, req)
+	}
+
+	resp, err := smsenderu.SendChunked(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Messages:   messages,
+	}, 10, send)
+	require.True(t, err.Is(smsenderu.PartialFailure))
+	require.Len(t, resp.IDs, len(recipients))
+	require.EqualValues(t, 3, calls)
+	require.LessOrEqual(t, maxInFlight, int32(smsenderu.CHUNKS_CONCURRENCY))
+
+	failed := 0
+	for i := range recipients {
+		if resp.IDs[i] == "" {
+			failed++
+			require.EqualValues(t, smsenderu.ERROR_CODE_NOT_SENT, resp.ErrorCodes[i])
+			require.EqualValues(t, recipients[i], resp.Results[i].Phone)
+			require.True(t, resp.Results[i].Err.Is(smsenderu.ProviderUnavailable))
+			continue
+		}
+		sent := q.SentTo(recipients[i])
+		require.Len(t, sent, 1)
+		require.EqualValues(t, resp.IDs[i], sent[0].ID)
+		require.EqualValues(t, messages[i], sent[0].Message)
+	}
+	require.Contains(t, []int{10, 5}, failed)
+}
+
+func TestCostChunked(t *testing.T) {
+	q := smsenderu_mock.New().
+		SetCostPerMessage(decimal.New(15, -1))
+
+	recipients := make([]string, 25)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("790000000%02d", i)
+	}
+
+	resp, err := smsenderu.CostChunked(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Message:    "Code: 1234",
+	}, 10, q.Cost)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.Costs, len(recipients))
+	require.EqualValues(t, "37.5", resp.Total.String())
+	require.Len(t, resp.Segments, len(recipients))
+	require.EqualValues(t, 25, resp.TotalSegments)
+}
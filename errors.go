@@ -0,0 +1,77 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+var (
+	// Canceled is an error class of the Sender's methods that have been
+	// interrupted because provided context.Context has been canceled.
+	Canceled = ekaerr.Interrupted.NewSubClass("Canceled")
+
+	// DeadlineExceeded is an error class of the Sender's methods that have been
+	// interrupted because provided context.Context's deadline has been passed.
+	DeadlineExceeded = ekaerr.TimeoutElapsed.NewSubClass("DeadlineExceeded")
+
+	// ProviderUnavailable is an error class of the API provider's server side
+	// failures (like temporary unavailability or internal server error).
+	// The request might be repeated later or using another provider.
+	ProviderUnavailable = ekaerr.ServiceUnavailable.NewSubClass("ProviderUnavailable")
+
+	// NotEnoughMoney is an error class of the API provider's rejection
+	// because of insufficient funds on the account.
+	NotEnoughMoney = ekaerr.RejectedOperation.NewSubClass("NotEnoughMoney")
+
+	// PartialFailure is an error class of Send() that has sent a message
+	// not to all recipients because some of its API requests have failed
+	// (see SendChunked(), SendEach()). SendMessageResponse is returned along with
+	// such error: the recipients of failed requests have ERROR_CODE_NOT_SENT
+	// error code and the cause in SendMessageResult's Err.
+	PartialFailure = ekaerr.ExternalError.NewSubClass("PartialFailure")
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// ERROR_CODE_NOT_SENT is the error code of the recipients the message
+	// has not been sent to, because the API request for them has failed.
+	// It's negative, so it doesn't match any provider's error code.
+	ERROR_CODE_NOT_SENT = -1
+)
+
+// ContextError returns an *ekaerr.Error of Canceled or DeadlineExceeded class
+// if provided ctx is done. Otherwise nil is returned.
+//
+// It's a helper for Sender's implementations that allows to report
+// about interrupted operations in the same recognizable way.
+func ContextError(ctx context.Context, message string) *ekaerr.Error {
+	return WrapContextError(ctx.Err(), message).
+		Throw()
+}
+
+// WrapContextError is the same as ContextError() but wraps provided legacyErr
+// if it's either context.Canceled or context.DeadlineExceeded.
+// Otherwise nil is returned.
+func WrapContextError(legacyErr error, message string) *ekaerr.Error {
+	switch legacyErr {
+
+	case context.DeadlineExceeded:
+		return DeadlineExceeded.Wrap(legacyErr, message).
+			WithString("description", "Context deadline has been exceeded.").
+			Throw()
+
+	case context.Canceled:
+		return Canceled.Wrap(legacyErr, message).
+			WithString("description", "Context has been canceled.").
+			Throw()
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// RetryableCoder is an optional interface of Sender that tells which of its
+	// error codes of recipients (SendMessageResponse.ErrorCodes) are temporary
+	// failures, so the message may be sent to such recipient by another Sender
+	// (see NewFailover()).
+	RetryableCoder interface {
+		IsRetryableCode(errorCode int) bool
+	}
+
+	senderFailover struct {
+		senders []Sender
+	}
+)
+
+// NewFailover returns a composite Sender that uses provided senders in order,
+// falling back to the next one when the current one fails because of
+// a transport error, a provider's server side error (ProviderUnavailable class),
+// a call timeout or insufficient funds (NotEnoughMoney class).
+//
+// Send() retries using the next Sender only those recipients, the message
+// has not been sent to because of a temporary failure: the API request for them
+// has failed (ERROR_CODE_NOT_SENT) or Sender reports a retryable error code
+// (see RetryableCoder). Other recipients the message has not been sent to
+// (e.g. of invalid phone numbers) keep their error codes. The results are merged back
+// into the one SendMessageResponse. IDs of sent messages are prefixed by the
+// index of Sender that has sent them (see ComposeMessageID()),
+// so Status() routes the ID back to that Sender.
+// A response returned along with an error of PartialFailure class is merged
+// as well, and such error is returned by Send() if the message has not been sent
+// to some recipients because of failed API requests (see ERROR_CODE_NOT_SENT).
+//
+// Balance(), BalanceIn(), Senders(), Cost() return the result of the first Sender
+// that succeeds. Check() fails only if all senders fail.
+func NewFailover(senders ...Sender) Sender {
+	return &senderFailover{senders: nonNilSenders(senders)}
+}
+
+func (q *senderFailover) Check(ctx context.Context) *ekaerr.Error {
+	const s = "Failover: Failed to check senders."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return err.
+			Throw()
+	}
+
+	var err *ekaerr.Error
+	for _, sender := range q.senders {
+		if err = sender.Check(ctx); err.IsNil() {
+			return nil
+		}
+		if !isFailoverError(ctx, err) {
+			break
+		}
+	}
+
+	return err.
+		AddMessage(s).
+		Throw()
+}
+
+func (q *senderFailover) Balance(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error) {
+	const s = "Failover: Failed to get balance."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, "", err.
+			Throw()
+	}
+
+	var err *ekaerr.Error
+	for _, sender := range q.senders {
+		var (
+			balance  decimal.Decimal
+			currency string
+		)
+		if balance, currency, err = sender.Balance(ctx); err.IsNil() {
+			return balance, currency, nil
+		}
+		if !isFailoverError(ctx, err) {
+			break
+		}
+	}
+
+	return decimal.Zero, "", err.
+		AddMessage(s).
+		Throw()
+}
+
+func (q *senderFailover) BalanceIn(ctx context.Context, currency string) (decimal.Decimal, *ekaerr.Error) {
+	const s = "Failover: Failed to get balance in the specified currency."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, err.
+			Throw()
+	}
+
+	var err *ekaerr.Error
+	for _, sender := range q.senders {
+		var balance decimal.Decimal
+		if balance, err = sender.BalanceIn(ctx, currency); err.IsNil() {
+			return balance, nil
+		}
+		if !isFailoverError(ctx, err) {
+			break
+		}
+	}
+
+	return decimal.Zero, err.
+		AddMessage(s).
+		Throw()
+}
+
+func (q *senderFailover) Senders(ctx context.Context) ([]string, *ekaerr.Error) {
+	const s = "Failover: Failed to get registered senders."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	var err *ekaerr.Error
+	for _, sender := range q.senders {
+		var senders []string
+		if senders, err = sender.Senders(ctx); err.IsNil() {
+			return senders, nil
+		}
+		if !isFailoverError(ctx, err) {
+			break
+		}
+	}
+
+	return nil, err.
+		AddMessage(s).
+		Throw()
+}
+
+func (q *senderFailover) Send(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failover: Failed to send a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	recipients := req.AllRecipients()
+	if len(recipients) == 0 {
+		return q.senders[0].Send(ctx, req)
+	}
+
+	resp = newSendResponse(len(recipients))
+
+	// pending is the indexes of recipients the message has not been sent to yet.
+	pending := make([]int, len(recipients))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	nResponses := 0
+	for i, sender := range q.senders {
+
+		var subResp *SendMessageResponse
+		subResp, err = sender.Send(ctx, subRequest(req, recipients, pending))
+
+		if err.IsNil() && !isSendResponseValid(subResp, len(pending)) {
+			err = ekaerr.IllegalState.New(s).
+				WithString("description", "Sender's response violates the IDs, ErrorCodes length contract.").
+				Throw()
+		}
+
+		if err.IsNotNil() && !isPartialFailure(subResp, err, len(pending)) {
+			if !isFailoverError(ctx, err) {
+				break
+			}
+			continue
+		}
+
+		nResponses++
+		mergeSendResponse(resp, subResp, pending, func(id string) string {
+			return ComposeMessageID(i, id)
+		})
+
+		stillPending := pending[:0]
+		for _, idx := range pending {
+			if resp.IDs[idx] == "" && isRetryableCode(sender, resp.ErrorCodes[idx]) {
+				stillPending = append(stillPending, idx)
+			}
+		}
+
+		if pending = stillPending; len(pending) == 0 {
+			break
+		}
+	}
+
+	if nResponses == 0 {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	resetMergedBalance(resp, nResponses)
+
+	if nNotSent := countNotSent(resp); nNotSent > 0 {
+		return resp, PartialFailure.New(s).
+			WithString("description", "Message has not been sent to some recipients by any Sender.").
+			WithInt("failed_recipients", nNotSent).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+func (q *senderFailover) Cost(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failover: Failed to get an info about cost of sending a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	for _, sender := range q.senders {
+		if resp, err = sender.Cost(ctx, req); err.IsNil() {
+			return resp, nil
+		}
+		if !isFailoverError(ctx, err) {
+			break
+		}
+	}
+
+	return nil, err.
+		AddMessage(s).
+		Throw()
+}
+
+func (q *senderFailover) Status(
+
+	ctx context.Context,
+	sentSmsId string,
+) (
+	resp *StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failover: Failed to get an info about message."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	idx, id, ok := ParseMessageID(sentSmsId)
+	if !ok || idx >= len(q.senders) {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "SMS ID has not been issued by this Sender.").
+			WithString("sms_id", sentSmsId).
+			Throw()
+	}
+
+	if resp, err = q.senders[idx].Status(ctx, id); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	resp.ID = sentSmsId
+	return resp, nil
+}
+
+// StatusBatch implements StatusBatcher. See StatusBatch() for the details.
+func (q *senderFailover) StatusBatch(
+
+	ctx context.Context,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failover: Failed to get an info about messages."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	if resp, err = statusBatchComposite(ctx, q.senders, sentSmsIds); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// validate returns an error if Sender is not initialized properly.
+func (q *senderFailover) validate(message string) *ekaerr.Error {
+	switch {
+
+	case q == nil:
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "Invalid sender object. Did you use NewFailover() constructor correctly?").
+			Throw()
+
+	case len(q.senders) == 0:
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "No senders are provided.").
+			Throw()
+	}
+
+	return nil
+}
+
+// isFailoverError reports whether err is an error after which the next
+// Sender should be used. Interruptions of ctx are not such errors,
+// but call timeouts that are shorter than ctx's deadline are.
+func isFailoverError(ctx context.Context, err *ekaerr.Error) bool {
+	switch {
+	case err.IsAnyDeep(ekaerr.ServiceUnavailable, NotEnoughMoney):
+		return true
+	case err.Is(DeadlineExceeded):
+		return ctx.Err() == nil
+	default:
+		return false
+	}
+}
+
+// isRetryableCode reports whether the message may be sent to the recipient
+// sender has reported errorCode for using another Sender.
+func isRetryableCode(sender Sender, errorCode int) bool {
+	if errorCode == ERROR_CODE_NOT_SENT {
+		return true
+	}
+	coder, ok := sender.(RetryableCoder)
+	return ok && coder.IsRetryableCode(errorCode)
+}
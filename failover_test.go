@@ -0,0 +1,141 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestFailover_Send(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailPhone("79000000001", smsenderu_mock.ERROR_CODE_NOT_ENOUGH_MONEY)
+	secondary := smsenderu_mock.New()
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 3)
+	require.Len(t, resp.ErrorCodes, 3)
+	for i := range resp.IDs {
+		require.NotEmpty(t, resp.IDs[i])
+		require.EqualValues(t, smsenderu_mock.STATUS_OK, resp.ErrorCodes[i])
+	}
+
+	require.Len(t, primary.Sent(), 2)
+	require.Len(t, secondary.Sent(), 1)
+	require.Len(t, secondary.SentTo("79000000001"), 1)
+
+	idx, id, ok := smsenderu.ParseMessageID(resp.IDs[1])
+	require.True(t, ok)
+	require.EqualValues(t, 1, idx)
+	require.EqualValues(t, secondary.Sent()[0].ID, id)
+
+	require.Len(t, resp.Results, 3)
+	require.EqualValues(t, resp.IDs[1], resp.Results[1].ID)
+	require.Nil(t, resp.Balance, "Balances of different senders must not be merged")
+
+	status, err := q.Status(context.Background(), resp.IDs[1])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, resp.IDs[1], status.ID)
+	require.EqualValues(t, "79000000001", status.Recipient)
+}
+
+func TestFailover_SendNotRetryableCode(t *testing.T) {
+	// The phone number is blocked by user (209 at sms.ru),
+	// another Sender must not be used for it.
+	const errorCodeBlocked = 209
+
+	primary := smsenderu_mock.New().
+		FailPhone("79000000001", errorCodeBlocked).
+		FailPhone("79000000002", smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER).
+		FailPhone("79000000003", smsenderu_mock.ERROR_CODE_NOT_ENOUGH_MONEY)
+	secondary := smsenderu_mock.New()
+
+	// Chain must keep the retryable codes of the chained Sender.
+	q := smsenderu.NewFailover(smsenderu.Chain(primary), secondary)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002", "79000000003"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotEmpty(t, resp.IDs[0])
+	require.Empty(t, resp.IDs[1])
+	require.Empty(t, resp.IDs[2])
+	require.EqualValues(t, errorCodeBlocked, resp.ErrorCodes[1])
+	require.EqualValues(t, smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[2])
+	require.NotEmpty(t, resp.IDs[3])
+
+	require.Len(t, secondary.Requests(), 1)
+	require.EqualValues(t, []string{"79000000003"}, secondary.Requests()[0].Recipients)
+}
+
+func TestFailover_SendProviderUnavailable(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, smsenderu.ProviderUnavailable, 1)
+	secondary := smsenderu_mock.New()
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 1)
+	require.Empty(t, primary.Sent())
+	require.Len(t, secondary.Sent(), 1)
+}
+
+func TestFailover_SendNotFailoverError(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, ekaerr.IllegalArgument, 1)
+	secondary := smsenderu_mock.New()
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.Empty(t, secondary.Sent())
+
+	primary.FailNext(smsenderu_mock.METHOD_SEND, ekaerr.UnsupportedOperation, 1)
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.Is(ekaerr.UnsupportedOperation))
+	require.Empty(t, secondary.Sent())
+}
+
+func TestFailover_SendAllFailed(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, ekaerr.ServiceUnavailable, 1)
+	secondary := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, smsenderu.NotEnoughMoney, 1)
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.Is(smsenderu.NotEnoughMoney))
+}
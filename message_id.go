@@ -0,0 +1,35 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ComposeMessageID returns an ID of message that has been sent by the idx-th
+// Sender of composite Sender (like NewFailover()), in the format "idx:id".
+func ComposeMessageID(idx int, id string) string {
+	return strconv.Itoa(idx) + ":" + id
+}
+
+// ParseMessageID splits an ID that has been composed by ComposeMessageID()
+// back to the index of Sender and the Sender's own message ID.
+// ok is false if composedID has been composed in other way.
+func ParseMessageID(composedID string) (idx int, id string, ok bool) {
+
+	i := strings.IndexByte(composedID, ':')
+	if i <= 0 || i == len(composedID)-1 {
+		return 0, "", false
+	}
+
+	idx, legacyErr := strconv.Atoi(composedID[:i])
+	if legacyErr != nil || idx < 0 {
+		return 0, "", false
+	}
+
+	return idx, composedID[i+1:], true
+}
@@ -0,0 +1,360 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// Method is a name of the Sender's method.
+	Method string
+
+	// CheckFunc is the signature of Sender.Check().
+	CheckFunc func(ctx context.Context) *ekaerr.Error
+
+	// BalanceFunc is the signature of Sender.Balance().
+	BalanceFunc func(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error)
+
+	// BalanceInFunc is the signature of Sender.BalanceIn().
+	BalanceInFunc func(ctx context.Context, currency string) (decimal.Decimal, *ekaerr.Error)
+
+	// SendersFunc is the signature of Sender.Senders().
+	SendersFunc func(ctx context.Context) ([]string, *ekaerr.Error)
+
+	// SendFunc is the signature of Sender.Send().
+	SendFunc func(ctx context.Context, req *SendMessageRequest) (*SendMessageResponse, *ekaerr.Error)
+
+	// CostFunc is the signature of Sender.Cost().
+	CostFunc func(ctx context.Context, req *SendMessageRequest) (*CostSendMessageResponse, *ekaerr.Error)
+
+	// StatusFunc is the signature of Sender.Status().
+	StatusFunc func(ctx context.Context, sentSmsId string) (*StatusMessageResponse, *ekaerr.Error)
+
+	// Middleware is a set of interceptors of Sender's methods.
+	// Each interceptor gets the next handler of the method in the chain
+	// and returns a new handler that usually does something and calls next.
+	// Nil interceptors are skipped, so the method is passed through as is.
+	//
+	// Use Chain() to apply middlewares to Sender.
+	Middleware struct {
+		Check     func(next CheckFunc) CheckFunc
+		Balance   func(next BalanceFunc) BalanceFunc
+		BalanceIn func(next BalanceInFunc) BalanceInFunc
+		Senders   func(next SendersFunc) SendersFunc
+		Send      func(next SendFunc) SendFunc
+		Cost      func(next CostFunc) CostFunc
+		Status    func(next StatusFunc) StatusFunc
+	}
+
+	// AroundFunc is an interceptor of any Sender's method. It must call next
+	// to continue the chain and return its error (or its own one).
+	// See Around() for the details.
+	AroundFunc func(ctx context.Context, method Method, next func(ctx context.Context) *ekaerr.Error) *ekaerr.Error
+
+	senderChain struct {
+		check     CheckFunc
+		balance   BalanceFunc
+		balanceIn BalanceInFunc
+		senders   SendersFunc
+		send      SendFunc
+		cost      CostFunc
+		status    StatusFunc
+
+		// isRetryableCode is the sender's one if it implements RetryableCoder.
+		isRetryableCode func(errorCode int) bool
+
+		// statusBatch is the sender's one if it implements StatusBatcher
+		// and no middleware intercepts Status.
+		statusBatch func(ctx context.Context, sentSmsIds []string) ([]*StatusMessageResponse, *ekaerr.Error)
+	}
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	METHOD_CHECK      Method = "Check"
+	METHOD_BALANCE    Method = "Balance"
+	METHOD_BALANCE_IN Method = "BalanceIn"
+	METHOD_SENDERS    Method = "Senders"
+	METHOD_SEND       Method = "Send"
+	METHOD_COST       Method = "Cost"
+	METHOD_STATUS     Method = "Status"
+)
+
+// Chain returns a Sender that calls sender's methods through provided middlewares.
+// The first middleware is the outermost one: it's called first
+// and it gets the result of all others.
+func Chain(sender Sender, middlewares ...Middleware) Sender {
+
+	if sender == nil {
+		return (*senderChain)(nil)
+	}
+
+	q := &senderChain{
+		check:     sender.Check,
+		balance:   sender.Balance,
+		balanceIn: sender.BalanceIn,
+		senders:   sender.Senders,
+		send:      sender.Send,
+		cost:      sender.Cost,
+		status:    sender.Status,
+	}
+
+	if coder, ok := sender.(RetryableCoder); ok {
+		q.isRetryableCode = coder.IsRetryableCode
+	}
+
+	if batcher, ok := sender.(StatusBatcher); ok {
+		q.statusBatch = batcher.StatusBatch
+	}
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		m := &middlewares[i]
+		if m.Check != nil {
+			q.check = m.Check(q.check)
+		}
+		if m.Balance != nil {
+			q.balance = m.Balance(q.balance)
+		}
+		if m.BalanceIn != nil {
+			q.balanceIn = m.BalanceIn(q.balanceIn)
+		}
+		if m.Senders != nil {
+			q.senders = m.Senders(q.senders)
+		}
+		if m.Send != nil {
+			q.send = m.Send(q.send)
+		}
+		if m.Cost != nil {
+			q.cost = m.Cost(q.cost)
+		}
+		if m.Status != nil {
+			q.status = m.Status(q.status)
+			// The sender's StatusBatch would bypass the interceptor.
+			q.statusBatch = nil
+		}
+	}
+
+	return q
+}
+
+// Around returns a Middleware that intercepts all Sender's methods
+// using the same interceptor. It's the simplest way to write logging, metrics,
+// tracing, etc. The results of method (except its error) are not available
+// to the interceptor, but it's able to replace ctx or return its own error
+// without calling next.
+func Around(interceptor AroundFunc) Middleware {
+	return Middleware{
+		Check: func(next CheckFunc) CheckFunc {
+			return func(ctx context.Context) *ekaerr.Error {
+				return interceptor(ctx, METHOD_CHECK, next)
+			}
+		},
+		Balance: func(next BalanceFunc) BalanceFunc {
+			return func(ctx context.Context) (balance decimal.Decimal, currency string, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_BALANCE, func(ctx context.Context) *ekaerr.Error {
+					balance, currency, err = next(ctx)
+					return err
+				})
+				return balance, currency, err
+			}
+		},
+		BalanceIn: func(next BalanceInFunc) BalanceInFunc {
+			return func(ctx context.Context, currency string) (balance decimal.Decimal, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_BALANCE_IN, func(ctx context.Context) *ekaerr.Error {
+					balance, err = next(ctx, currency)
+					return err
+				})
+				return balance, err
+			}
+		},
+		Senders: func(next SendersFunc) SendersFunc {
+			return func(ctx context.Context) (senders []string, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_SENDERS, func(ctx context.Context) *ekaerr.Error {
+					senders, err = next(ctx)
+					return err
+				})
+				return senders, err
+			}
+		},
+		Send: func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *SendMessageRequest) (resp *SendMessageResponse, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_SEND, func(ctx context.Context) *ekaerr.Error {
+					resp, err = next(ctx, req)
+					return err
+				})
+				return resp, err
+			}
+		},
+		Cost: func(next CostFunc) CostFunc {
+			return func(ctx context.Context, req *SendMessageRequest) (resp *CostSendMessageResponse, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_COST, func(ctx context.Context) *ekaerr.Error {
+					resp, err = next(ctx, req)
+					return err
+				})
+				return resp, err
+			}
+		},
+		Status: func(next StatusFunc) StatusFunc {
+			return func(ctx context.Context, sentSmsId string) (resp *StatusMessageResponse, err *ekaerr.Error) {
+				err = interceptor(ctx, METHOD_STATUS, func(ctx context.Context) *ekaerr.Error {
+					resp, err = next(ctx, sentSmsId)
+					return err
+				})
+				return resp, err
+			}
+		},
+	}
+}
+
+func (q *senderChain) Check(ctx context.Context) *ekaerr.Error {
+	const s = "Chain: Failed to check sender."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return err.
+			Throw()
+	}
+
+	return q.check(ctx)
+}
+
+func (q *senderChain) Balance(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error) {
+	const s = "Chain: Failed to get balance."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, "", err.
+			Throw()
+	}
+
+	return q.balance(ctx)
+}
+
+func (q *senderChain) BalanceIn(ctx context.Context, currency string) (decimal.Decimal, *ekaerr.Error) {
+	const s = "Chain: Failed to get balance in the specified currency."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, err.
+			Throw()
+	}
+
+	return q.balanceIn(ctx, currency)
+}
+
+func (q *senderChain) Senders(ctx context.Context) ([]string, *ekaerr.Error) {
+	const s = "Chain: Failed to get registered senders."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	return q.senders(ctx)
+}
+
+func (q *senderChain) Send(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Chain: Failed to send a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	return q.send(ctx, req)
+}
+
+func (q *senderChain) Cost(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Chain: Failed to get an info about cost of sending a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	return q.cost(ctx, req)
+}
+
+func (q *senderChain) Status(
+
+	ctx context.Context,
+	sentSmsId string,
+) (
+	resp *StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Chain: Failed to get an info about message."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	return q.status(ctx, sentSmsId)
+}
+
+// StatusBatch implements StatusBatcher using the chained Sender's one.
+// If the chained Sender doesn't implement it or some middleware intercepts
+// Status, Status is called for each ID through the chain.
+func (q *senderChain) StatusBatch(
+
+	ctx context.Context,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Chain: Failed to get an info about messages."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	if q.statusBatch != nil {
+		return q.statusBatch(ctx, sentSmsIds)
+	}
+
+	if resp, err = statusEach(ctx, q.status, sentSmsIds); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// IsRetryableCode implements RetryableCoder using the chained Sender's one.
+// No code is retryable if the chained Sender doesn't implement it.
+func (q *senderChain) IsRetryableCode(errorCode int) bool {
+	return q != nil && q.isRetryableCode != nil && q.isRetryableCode(errorCode)
+}
+
+// validate returns an error if Sender is not initialized properly.
+func (q *senderChain) validate(message string) *ekaerr.Error {
+	if q == nil {
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "Invalid sender object. Did you use Chain() with not nil Sender?").
+			Throw()
+	}
+	return nil
+}
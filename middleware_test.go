@@ -0,0 +1,112 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+
+	trace := func(name string) smsenderu.Middleware {
+		return smsenderu.Around(func(
+			ctx context.Context, method smsenderu.Method, next func(ctx context.Context) *ekaerr.Error,
+		) *ekaerr.Error {
+			calls = append(calls, name+">"+string(method))
+			err := next(ctx)
+			calls = append(calls, name+"<"+string(method))
+			return err
+		})
+	}
+
+	q := smsenderu.Chain(smsenderu_mock.New(), trace("a"), trace("b"))
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 1)
+	require.EqualValues(t, []string{"a>Send", "b>Send", "b<Send", "a<Send"}, calls)
+}
+
+func TestChain_Intercept(t *testing.T) {
+	sender := smsenderu_mock.New()
+
+	reject := smsenderu.Middleware{
+		Send: func(next smsenderu.SendFunc) smsenderu.SendFunc {
+			return func(ctx context.Context, req *smsenderu.SendMessageRequest) (*smsenderu.SendMessageResponse, *ekaerr.Error) {
+				if req.Message == "" {
+					return nil, ekaerr.IllegalArgument.New("Empty message.").Throw()
+				}
+				return next(ctx, req)
+			}
+		},
+	}
+
+	q := smsenderu.Chain(sender, reject)
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{Recipient: "79000000000"})
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.Empty(t, sender.Requests())
+
+	// Methods without interceptors are passed through.
+	require.True(t, q.Check(context.Background()).IsNil())
+}
+
+// batchingSender is a mock Sender that implements StatusBatcher
+// and counts its calls.
+type batchingSender struct {
+	*smsenderu_mock.Sender
+	batches int
+}
+
+func (q *batchingSender) StatusBatch(ctx context.Context, sentSmsIds []string) ([]*smsenderu.StatusMessageResponse, *ekaerr.Error) {
+	q.batches++
+	return smsenderu.StatusBatch(ctx, q.Sender, sentSmsIds)
+}
+
+func TestChain_StatusBatch(t *testing.T) {
+	sender := &batchingSender{Sender: smsenderu_mock.New()}
+
+	resp, err := sender.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+
+	// Sender's StatusBatch is used through the chain, that doesn't intercept Status.
+	q := smsenderu.NewRateLimiter(sender, smsenderu.RateLimits{})
+	statuses, err := smsenderu.StatusBatch(context.Background(), q, resp.IDs)
+	require.True(t, err.IsNil())
+	require.Len(t, statuses, 2)
+	require.EqualValues(t, "79000000001", statuses[1].Recipient)
+	require.EqualValues(t, 1, sender.batches)
+
+	// Status interceptor is not bypassed, Status is called for each ID.
+	var calls []smsenderu.Method
+	q = smsenderu.Chain(sender, smsenderu.Around(func(
+		ctx context.Context, method smsenderu.Method, next func(ctx context.Context) *ekaerr.Error,
+	) *ekaerr.Error {
+		calls = append(calls, method)
+		return next(ctx)
+	}))
+	statuses, err = smsenderu.StatusBatch(context.Background(), q, resp.IDs)
+	require.True(t, err.IsNil())
+	require.Len(t, statuses, 2)
+	require.EqualValues(t, "79000000001", statuses[1].Recipient)
+	require.EqualValues(t, 1, sender.batches)
+	require.EqualValues(t, []smsenderu.Method{smsenderu.METHOD_STATUS, smsenderu.METHOD_STATUS}, calls)
+}
@@ -0,0 +1,547 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_mock provides an in-memory smsenderu.Sender
+// that is intended to be used in unit tests of applications
+// that are built on top of smsenderu.Sender.
+package smsenderu_mock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+	"github.com/qioalice/ekago/v3/ekatime"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/segment"
+)
+
+type (
+	// Sender is an in-memory smsenderu.Sender. It never does any network call,
+	// records each request of sending message and allows to program failures,
+	// balance and delivery statuses. It's safe for concurrent use.
+	//
+	// Error codes that Sender uses are the same as sms.ru's ones.
+	Sender struct {
+		mu sync.Mutex
+
+		balance        decimal.Decimal
+		currency       string
+		costPerMessage decimal.Decimal
+		senders        []string
+
+		phoneErrors map[string]int
+		callErrors  map[Method][]ekaerr.Class
+		hlr         map[string]smsenderu.HLRResult
+
+		statusFlow []int
+
+		requests []smsenderu.SendMessageRequest
+		messages []*SentMessage
+		byID     map[string]*SentMessage
+		nextID   int
+	}
+
+	// SentMessage is a message that has been sent to the one recipient.
+	SentMessage struct {
+		ID        string
+		Recipient string
+		Message   string
+		From      string
+		SentAt    ekatime.Timestamp
+		Cost      decimal.Decimal
+
+		// Request is the request this message has been sent by.
+		Request *smsenderu.SendMessageRequest
+
+		// HLR is the result of HLR lookup or ping-SMS, if it's the one.
+		HLR *smsenderu.HLRResult
+
+		statusIdx  int
+		statusFlow []int
+	}
+
+	// Method is a name of the smsenderu.Sender's method.
+	Method = smsenderu.Method
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	METHOD_CHECK      = smsenderu.METHOD_CHECK
+	METHOD_BALANCE    = smsenderu.METHOD_BALANCE
+	METHOD_BALANCE_IN = smsenderu.METHOD_BALANCE_IN
+	METHOD_SENDERS    = smsenderu.METHOD_SENDERS
+	METHOD_SEND       = smsenderu.METHOD_SEND
+	METHOD_COST       = smsenderu.METHOD_COST
+	METHOD_STATUS     = smsenderu.METHOD_STATUS
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	ERROR_CODE_MESSAGE_NOT_FOUND = -1
+
+	STATUS_OK                  = 100
+	STATUS_PENDING_BY_OPERATOR = 101
+	STATUS_PENDING             = 102
+	STATUS_DELIVERED           = 103
+
+	ERROR_CODE_NOT_ENOUGH_MONEY = 201
+	ERROR_CODE_BAD_PHONE_NUMBER = 202
+)
+
+// New returns a new mock Sender with 0 RUB balance, free messages,
+// no senders, and a delivery status flow STATUS_PENDING, STATUS_DELIVERED.
+func New() *Sender {
+	return &Sender{
+		balance:        decimal.Zero,
+		currency:       "RUB",
+		costPerMessage: decimal.Zero,
+		phoneErrors:    make(map[string]int),
+		callErrors:     make(map[Method][]ekaerr.Class),
+		hlr:            make(map[string]smsenderu.HLRResult),
+		statusFlow:     []int{STATUS_PENDING, STATUS_DELIVERED},
+		byID:           make(map[string]*SentMessage),
+	}
+}
+
+// SetBalance sets the current balance and its currency.
+func (q *Sender) SetBalance(balance decimal.Decimal, currency string) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.balance, q.currency = balance, strings.ToUpper(strings.TrimSpace(currency))
+	return q
+}
+
+// SetCostPerMessage sets the cost of sending one message to one recipient.
+// The balance is decreased by that cost for each successfully sent message.
+// If balance is not enough, ERROR_CODE_NOT_ENOUGH_MONEY is reported for recipient.
+func (q *Sender) SetCostPerMessage(cost decimal.Decimal) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.costPerMessage = cost
+	return q
+}
+
+// SetSenders sets the list of senders Senders() returns.
+func (q *Sender) SetSenders(senders ...string) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.senders = append([]string(nil), senders...)
+	return q
+}
+
+// FailPhone makes Send() to report provided error code for the provided
+// phone number instead of sending message. Zero code removes the rule.
+func (q *Sender) FailPhone(phone string, code int) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if code == 0 {
+		delete(q.phoneErrors, phone)
+	} else {
+		q.phoneErrors[phone] = code
+	}
+	return q
+}
+
+// FailNext makes the next n calls of provided method to fail
+// with an error of provided class. Calls are queued, so you may program
+// the different errors for the consequent calls.
+func (q *Sender) FailNext(method Method, cls ekaerr.Class, n int) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := 0; i < n; i++ {
+		q.callErrors[method] = append(q.callErrors[method], cls)
+	}
+	return q
+}
+
+// SetHLR sets the result of HLR lookup (and ping-SMS) for the provided phone number.
+// By default, each phone is reachable in its home network.
+func (q *Sender) SetHLR(phone string, result smsenderu.HLRResult) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.hlr[phone] = result
+	return q
+}
+
+// SetStatusFlow sets the sequence of delivery statuses each message goes through.
+// Each Status() call advances message to the next status until the last one.
+// It affects only messages that will be sent after this call.
+func (q *Sender) SetStatusFlow(statuses ...int) *Sender {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(statuses) > 0 {
+		q.statusFlow = append([]int(nil), statuses...)
+	}
+	return q
+}
+
+// Requests returns the copies of all requests that have been passed to Send(),
+// in the order they were passed, including failed ones.
+func (q *Sender) Requests() []smsenderu.SendMessageRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]smsenderu.SendMessageRequest(nil), q.requests...)
+}
+
+// Sent returns all successfully sent messages in the order they were sent.
+func (q *Sender) Sent() []SentMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sent := make([]SentMessage, len(q.messages))
+	for i, message := range q.messages {
+		sent[i] = *message
+	}
+	return sent
+}
+
+// SentTo returns all successfully sent messages to the provided phone number
+// in the order they were sent.
+func (q *Sender) SentTo(phone string) []SentMessage {
+	var sent []SentMessage
+	for _, message := range q.Sent() {
+		if message.Recipient == phone {
+			sent = append(sent, message)
+		}
+	}
+	return sent
+}
+
+// Reset forgets all recorded requests and sent messages.
+// Programmed balance, costs, failures and statuses are kept.
+func (q *Sender) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requests = nil
+	q.messages = nil
+	q.byID = make(map[string]*SentMessage)
+}
+
+func (q *Sender) Check(ctx context.Context) *ekaerr.Error {
+	const s = "Mock: Failed to check credentials."
+	return q.beforeCall(ctx, METHOD_CHECK, s).
+		Throw()
+}
+
+func (q *Sender) Balance(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error) {
+	const s = "Mock: Failed to get balance."
+	if err := q.beforeCall(ctx, METHOD_BALANCE, s); err.IsNotNil() {
+		return decimal.Zero, "", err.
+			Throw()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.balance, q.currency, nil
+}
+
+func (q *Sender) BalanceIn(ctx context.Context, currency string) (decimal.Decimal, *ekaerr.Error) {
+	const s = "Mock: Failed to get balance in the specified currency."
+	if err := q.beforeCall(ctx, METHOD_BALANCE_IN, s); err.IsNotNil() {
+		return decimal.Zero, err.
+			Throw()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if currency = strings.ToUpper(strings.TrimSpace(currency)); currency != q.currency {
+		return decimal.Zero, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Incorrect currency.").
+			WithString("mock_required_currency", currency).
+			WithString("mock_currency", q.currency).
+			Throw()
+	}
+	return q.balance, nil
+}
+
+func (q *Sender) Senders(ctx context.Context) ([]string, *ekaerr.Error) {
+	const s = "Mock: Failed to get registered senders."
+	if err := q.beforeCall(ctx, METHOD_SENDERS, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.senders...), nil
+}
+
+func (q *Sender) Send(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+) (
+	resp *smsenderu.SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Mock: Failed to send a message(s)."
+
+	if q != nil && req != nil {
+		q.mu.Lock()
+		q.requests = append(q.requests, copyRequest(req))
+		q.mu.Unlock()
+	}
+
+	if err = q.beforeCall(ctx, METHOD_SEND, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	if whyInvalid := whyRequestInvalid(req); len(whyInvalid) > 0 {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Incorrect argument(s) of sending message request.").
+			WithString("mock_send_request_why_invalid", whyInvalid.String()).
+			Throw()
+	}
+
+	// Mock has no native form of personalized messages, like many providers.
+	// The whole request is checked above, then each message is sent separately.
+	if len(req.Messages) > 0 {
+		return smsenderu.SendEach(ctx, req, q.send)
+	}
+
+	return q.send(ctx, req)
+}
+
+// send sends a message of the valid request. It's Send() without
+// recording the request, programmed failures and validation.
+func (q *Sender) send(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+) (
+	resp *smsenderu.SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	recipients := req.AllRecipients()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	resp = &smsenderu.SendMessageResponse{
+		IDs:        make([]string, len(recipients)),
+		ErrorCodes: make([]int, len(recipients)),
+		Results:    make([]smsenderu.SendMessageResult, len(recipients)),
+	}
+
+	reqCopy := copyRequest(req)
+	for i, recipient := range recipients {
+
+		resp.Results[i].Phone = recipient
+
+		if code, ok := q.phoneErrors[recipient]; ok {
+			resp.ErrorCodes[i] = code
+			resp.Results[i].ErrorCode = code
+			continue
+		}
+
+		if q.balance.LessThan(q.costPerMessage) {
+			resp.ErrorCodes[i] = ERROR_CODE_NOT_ENOUGH_MONEY
+			resp.Results[i].ErrorCode = ERROR_CODE_NOT_ENOUGH_MONEY
+			continue
+		}
+
+		q.nextID++
+		message := &SentMessage{
+			ID:         fmt.Sprintf("mock-%d", q.nextID),
+			Recipient:  recipient,
+			Message:    req.Message,
+			From:       req.From,
+			SentAt:     ekatime.NewTimestampNow(),
+			Cost:       q.costPerMessage,
+			Request:    &reqCopy,
+			HLR:        q.hlrOf(req, recipient),
+			statusFlow: q.statusFlow,
+		}
+
+		q.balance = q.balance.Sub(q.costPerMessage)
+		q.messages = append(q.messages, message)
+		q.byID[message.ID] = message
+
+		resp.IDs[i] = message.ID
+		resp.ErrorCodes[i] = STATUS_OK
+		resp.Results[i] = smsenderu.SendMessageResult{
+			Phone:     recipient,
+			ID:        message.ID,
+			ErrorCode: STATUS_OK,
+			Cost:      q.costPerMessage,
+			Segments:  smsenderu_segment.Segments(message.Message),
+		}
+	}
+
+	balance := q.balance
+	resp.Balance = &balance
+
+	return resp, nil
+}
+
+func (q *Sender) Cost(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+) (
+	resp *smsenderu.CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Mock: Failed to get an info about cost of sending a message(s)."
+
+	if err = q.beforeCall(ctx, METHOD_COST, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	if whyInvalid := whyRequestInvalid(req); len(whyInvalid) > 0 {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Incorrect argument(s) of sending message request.").
+			WithString("mock_cost_request_why_invalid", whyInvalid.String()).
+			Throw()
+	}
+
+	recipients := req.AllRecipients()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	resp = &smsenderu.CostSendMessageResponse{
+		Costs:    make([]decimal.Decimal, len(recipients)),
+		Total:    decimal.Zero,
+		Segments: make([]int, len(recipients)),
+	}
+
+	for i, message := range req.AllMessages() {
+		resp.Costs[i] = q.costPerMessage
+		resp.Total = resp.Total.Add(q.costPerMessage)
+		resp.Segments[i] = smsenderu_segment.Segments(message)
+		resp.TotalSegments += resp.Segments[i]
+	}
+
+	return resp, nil
+}
+
+func (q *Sender) Status(
+
+	ctx context.Context,
+	sentSmsId string,
+) (
+	resp *smsenderu.StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Mock: Failed to get an info about message."
+
+	if err = q.beforeCall(ctx, METHOD_STATUS, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	if sentSmsId == "" {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "SMS ID is empty or not provided.").
+			Throw()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	message, ok := q.byID[sentSmsId]
+	if !ok {
+		return &smsenderu.StatusMessageResponse{
+			ID:        sentSmsId,
+			ErrorCode: ERROR_CODE_MESSAGE_NOT_FOUND,
+			NotFound:  true,
+		}, nil
+	}
+
+	resp = &smsenderu.StatusMessageResponse{
+		ID:        message.ID,
+		ErrorCode: message.statusFlow[message.statusIdx],
+		Recipient: message.Recipient,
+		Message:   message.Message,
+		From:      message.From,
+		SendAt:    message.SentAt,
+		UpdatedAt: ekatime.NewTimestampNow(),
+	}
+
+	if message.HLR != nil {
+		hlr := *message.HLR
+		resp.HLR = &hlr
+	}
+
+	if message.statusIdx < len(message.statusFlow)-1 {
+		message.statusIdx++
+	}
+
+	return resp, nil
+}
+
+// IsRetryableCode implements smsenderu.RetryableCoder.
+// Only ERROR_CODE_NOT_ENOUGH_MONEY is retryable.
+func (q *Sender) IsRetryableCode(errorCode int) bool {
+	return errorCode == ERROR_CODE_NOT_ENOUGH_MONEY
+}
+
+// beforeCall returns an error if either ctx is done or a failure
+// has been programmed for the method using FailNext().
+func (q *Sender) beforeCall(ctx context.Context, method Method, message string) *ekaerr.Error {
+
+	if q == nil {
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "Invalid sender object. Did you use New() constructor correctly?").
+			Throw()
+	}
+
+	if ctx != nil {
+		if err := smsenderu.ContextError(ctx, message); err.IsNotNil() {
+			return err.
+				Throw()
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	classes := q.callErrors[method]
+	if len(classes) == 0 {
+		return nil
+	}
+
+	q.callErrors[method] = classes[1:]
+	return classes[0].New(message).
+		WithString("description", "Programmed failure.").
+		WithString("mock_method", string(method)).
+		Throw()
+}
+
+// hlrOf returns the result of HLR lookup or ping-SMS of the recipient,
+// or nil if req is a regular message. q.mu must be locked.
+func (q *Sender) hlrOf(req *smsenderu.SendMessageRequest, recipient string) *smsenderu.HLRResult {
+	if !req.IsHLR && !req.IsPing {
+		return nil
+	}
+	result, ok := q.hlr[recipient]
+	if !ok {
+		result = smsenderu.HLRResult{Reachable: true}
+	}
+	if req.IsPing {
+		result = smsenderu.HLRResult{Reachable: result.Reachable}
+	}
+	return &result
+}
+
+// whyRequestInvalid returns the violations of the rules by SendMessageRequest:
+// the common ones and TTL in the range [1m..24h].
+func whyRequestInvalid(req *smsenderu.SendMessageRequest) smsenderu.ValidationErrors {
+	return smsenderu.Validate(req, smsenderu.TTLWithin(1*time.Minute, 24*time.Hour))
+}
+
+// copyRequest returns a deep copy of SendMessageRequest.
+func copyRequest(req *smsenderu.SendMessageRequest) smsenderu.SendMessageRequest {
+	reqCopy := *req
+	reqCopy.Recipients = append([]string(nil), req.Recipients...)
+	reqCopy.Messages = append([]string(nil), req.Messages...)
+	return reqCopy
+}
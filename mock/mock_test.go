@@ -0,0 +1,166 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_mock_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+	"github.com/qioalice/smsenderu/sendertest"
+)
+
+func TestSender_Send(t *testing.T) {
+	q := smsenderu_mock.New().
+		SetBalance(decimal.New(3, 0), "RUB").
+		SetCostPerMessage(decimal.New(1, 0)).
+		FailPhone("79000000000", smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79123456789", "79000000000", "79123456780", "79123456781", "79123456782"},
+		Message:    "Code: 1234",
+	}
+
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 5)
+	require.Len(t, resp.ErrorCodes, 5)
+	require.EqualValues(t, []int{
+		smsenderu_mock.STATUS_OK,
+		smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER,
+		smsenderu_mock.STATUS_OK,
+		smsenderu_mock.STATUS_OK,
+		smsenderu_mock.ERROR_CODE_NOT_ENOUGH_MONEY,
+	}, resp.ErrorCodes)
+	require.EqualValues(t, resp.IDs[2], resp.Results[2].ID)
+	require.EqualValues(t, "1", resp.Results[2].Cost.String())
+	require.True(t, resp.Balance.IsZero())
+
+	require.Len(t, q.Requests(), 1)
+	require.Len(t, q.Sent(), 3)
+	require.Len(t, q.SentTo("79123456789"), 1)
+	require.Empty(t, q.SentTo("79000000000"))
+
+	balance, _, err := q.Balance(context.Background())
+	require.True(t, err.IsNil())
+	require.True(t, balance.IsZero())
+}
+
+func TestSender_FailNext(t *testing.T) {
+	q := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_CHECK, ekaerr.ServiceUnavailable, 1)
+
+	err := q.Check(context.Background())
+	require.True(t, err.Is(ekaerr.ServiceUnavailable))
+	require.True(t, q.Check(context.Background()).IsNil())
+}
+
+func TestSender_SendPersonalized(t *testing.T) {
+	q := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, ekaerr.ServiceUnavailable, 1)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79123456789", "79123456780", "79123456781"},
+		Messages:   []string{"Hello, Ann", "", "Hello, Eve"},
+	}
+
+	// The programmed failure fails the whole request, not one message.
+	_, err := q.Send(context.Background(), req)
+	require.True(t, err.Is(ekaerr.ServiceUnavailable))
+	require.Empty(t, q.Sent())
+
+	// The invalid message fails the whole request.
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.Empty(t, q.Sent())
+
+	req.Messages[1] = "Hello, Bob"
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 3)
+	require.Len(t, q.Sent(), 3)
+	require.Len(t, q.Requests(), 3)
+	require.EqualValues(t, "Hello, Bob", q.SentTo("79123456780")[0].Message)
+}
+
+func TestSender_Status(t *testing.T) {
+	q := smsenderu_mock.New().
+		SetStatusFlow(smsenderu_mock.STATUS_PENDING, smsenderu_mock.STATUS_DELIVERED)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79123456789",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+
+	for _, expected := range []int{
+		smsenderu_mock.STATUS_PENDING,
+		smsenderu_mock.STATUS_DELIVERED,
+		smsenderu_mock.STATUS_DELIVERED,
+	} {
+		status, err := q.Status(context.Background(), resp.IDs[0])
+		require.True(t, err.IsNil())
+		require.EqualValues(t, expected, status.ErrorCode)
+	}
+
+	status, err := q.Status(context.Background(), "unknown")
+	require.True(t, err.IsNil())
+	require.EqualValues(t, smsenderu_mock.ERROR_CODE_MESSAGE_NOT_FOUND, status.ErrorCode)
+}
+
+func TestSender_Conformance(t *testing.T) {
+	smsenderu_sendertest.Run(t, smsenderu_sendertest.Config{
+		NewSender: func(_ *testing.T) smsenderu.Sender {
+			return smsenderu_mock.New()
+		},
+		NilSender:  (*smsenderu_mock.Sender)(nil),
+		Recipients: []string{"79123456789", "79123456780"},
+		StatusOK:   smsenderu_mock.STATUS_OK,
+	})
+}
+
+func TestSender_HLR(t *testing.T) {
+	q := smsenderu_mock.New().
+		SetHLR("79000000001", smsenderu.HLRResult{
+			Reachable:       true,
+			Roaming:         true,
+			HomeOperator:    "MTS",
+			CurrentOperator: "Vodafone",
+		}).
+		SetHLR("79000000002", smsenderu.HLRResult{Reachable: false})
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000001", "79000000002"},
+		IsHLR:      true,
+	})
+	require.True(t, err.IsNil())
+
+	status, err := q.Status(context.Background(), resp.IDs[0])
+	require.True(t, err.IsNil())
+	require.NotNil(t, status.HLR)
+	require.True(t, status.HLR.Roaming)
+	require.EqualValues(t, "Vodafone", status.HLR.CurrentOperator)
+
+	status, err = q.Status(context.Background(), resp.IDs[1])
+	require.True(t, err.IsNil())
+	require.False(t, status.HLR.Reachable)
+
+	resp, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000001",
+		IsPing:    true,
+	})
+	require.True(t, err.IsNil())
+
+	status, err = q.Status(context.Background(), resp.IDs[0])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, smsenderu.HLRResult{Reachable: true}, *status.HLR)
+}
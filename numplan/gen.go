@@ -0,0 +1,156 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+//go:build ignore
+// +build ignore
+
+// gen.go generates registry.go, the bundled extract of Rossvyaz registry,
+// from the registry CSV files published at
+// https://opendata.digital.gov.ru/registry/numeric/downloads
+// (DEF-9xx.csv and optionally ABC-3xx.csv, ABC-4xx.csv, ABC-8xx.csv).
+// Each source is either a path to the downloaded file or its URL:
+//
+//	go run gen.go DEF-9xx.csv
+//
+// Only the columns Parse() uses are kept (code, from, to, capacity,
+// operator, region, INN), they are found by the header of each file,
+// so the extra columns of the newer registry files are dropped.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/qioalice/smsenderu/numplan"
+)
+
+const output = "registry.go"
+
+// columns are the headers of the columns that are kept, in the order of Parse().
+// The first column (the code, "АВС/ DEF") is always the first one in the source.
+var columns = []string{"от", "до", "емкость", "оператор", "регион", "инн"}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: go run gen.go <registry csv path or url>...")
+		os.Exit(2)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = ';'
+
+	_ = w.Write([]string{"АВС/ DEF", "От", "До", "Емкость", "Оператор", "Регион", "ИНН"})
+	for _, src := range os.Args[1:] {
+		if err := extract(src, w); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", src, err)
+			os.Exit(1)
+		}
+	}
+	w.Flush()
+
+	plan, err := smsenderu_numplan.Parse(bytes.NewReader(buf.Bytes()))
+	if err.IsNotNil() {
+		fmt.Fprintln(os.Stderr, "Generated registry is not parsed by smsenderu_numplan.Parse().")
+		os.Exit(1)
+	}
+	if bytes.IndexByte(buf.Bytes(), '`') != -1 {
+		fmt.Fprintln(os.Stderr, "Registry contains a backquote, it can't be a raw string literal.")
+		os.Exit(1)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package smsenderu_numplan\n\n")
+	fmt.Fprintf(&out, "// bundledRegistry is an extract of Rossvyaz registry (%d ranges),\n", plan.Len())
+	fmt.Fprintf(&out, "// generated at %s.\n", time.Now().UTC().Format("2006-01-02"))
+	fmt.Fprintf(&out, "const bundledRegistry = `%s`\n", buf.Bytes())
+
+	if err := ioutil.WriteFile(output, out.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// extract writes the kept columns of each range of the registry CSV
+// (path or URL) to w.
+func extract(src string, w *csv.Writer) error {
+
+	r, err := open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cr := csv.NewReader(r)
+	cr.Comma = ';'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j := range header {
+			if strings.ToLower(strings.TrimSpace(header[j])) == column {
+				indexes[i] = j
+			}
+		}
+		if indexes[i] == -1 && column != "инн" {
+			return fmt.Errorf("there is no column %q", column)
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		kept := []string{strings.TrimSpace(record[0])}
+		for _, idx := range indexes {
+			field := ""
+			if idx != -1 && idx < len(record) {
+				field = strings.TrimSpace(record[idx])
+			}
+			kept = append(kept, field)
+		}
+		if err := w.Write(kept); err != nil {
+			return err
+		}
+	}
+}
+
+// open opens the registry file, or downloads it if src is URL.
+func open(src string) (io.ReadCloser, error) {
+
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		return os.Open(src)
+	}
+
+	resp, err := http.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
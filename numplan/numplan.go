@@ -0,0 +1,243 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_numplan provides an offline lookup of the operator
+// and the region of Russian phone numbers using the numbering plan
+// (DEF and ABC codes ranges) in the format of Rossvyaz registry CSV:
+//     АВС/ DEF;От;До;Емкость;Оператор;Регион;ИНН
+//     912;0000000;0999999;1000000;ПАО "Мобильные ТелеСистемы";Свердловская обл.;7740000076
+//
+// The package has a bundled extract of the registry (see Default()),
+// that is generated by gen.go from the registry files published at
+// https://opendata.digital.gov.ru/registry/numeric/downloads.
+// The numbering plan is changed often, so regenerate the bundled one,
+// or load the actual registry at runtime using ParseFile(), SetDefault().
+// Keep in mind that numbers are ported between operators,
+// so the operator of the range is not always the actual one.
+package smsenderu_numplan
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu/phone"
+)
+
+type (
+	// Plan is a parsed numbering plan. It's immutable and safe for concurrent use.
+	Plan struct {
+		ranges []numberRange
+	}
+
+	// Info is an info about phone number from the numbering plan.
+	Info struct {
+		Country  string // ISO 3166-1 alpha-2, always "RU" for now
+		Region   string
+		Operator string
+		INN      string // operator's taxpayer ID, if presented in registry
+	}
+
+	// numberRange is a range of national (10 digits) phone numbers
+	// [from..to] assigned to the same operator in the same region.
+	numberRange struct {
+		from, to int64
+		info     *Info
+	}
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	COUNTRY_RU = "RU"
+)
+
+var (
+	defaultPlan     *Plan
+	defaultPlanOnce sync.Once
+	defaultPlanMu   sync.RWMutex
+)
+
+// Default returns the process-wide numbering plan. Until SetDefault() is called,
+// it's the registry extract bundled into the package (see registry.go).
+func Default() *Plan {
+	defaultPlanOnce.Do(func() {
+		plan, err := Parse(strings.NewReader(bundledRegistry))
+		if err.IsNotNil() {
+			panic("smsenderu_numplan: Bundled registry is broken.")
+		}
+		defaultPlanMu.Lock()
+		if defaultPlan == nil {
+			defaultPlan = plan
+		}
+		defaultPlanMu.Unlock()
+	})
+
+	defaultPlanMu.RLock()
+	defer defaultPlanMu.RUnlock()
+	return defaultPlan
+}
+
+// SetDefault replaces the process-wide numbering plan, the Default() returns.
+// Use it to apply the actual registry. Nil is ignored.
+func SetDefault(plan *Plan) {
+	if plan == nil {
+		return
+	}
+	defaultPlanOnce.Do(func() {})
+	defaultPlanMu.Lock()
+	defer defaultPlanMu.Unlock()
+	defaultPlan = plan
+}
+
+// ParseFile parses the Rossvyaz registry CSV file (or a concatenation
+// of DEF and ABC files). See Parse() for the details.
+func ParseFile(path string) (*Plan, *ekaerr.Error) {
+	const s = "Failed to parse numbering plan file."
+
+	f, legacyErr := os.Open(path)
+	if legacyErr != nil {
+		return nil, ekaerr.DataUnavailable.Wrap(legacyErr, s).
+			WithString("numplan_path", path).
+			Throw()
+	}
+	defer f.Close()
+
+	plan, err := Parse(f)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			WithString("numplan_path", path).
+			Throw()
+	}
+
+	return plan, nil
+}
+
+// Parse parses the Rossvyaz registry CSV (semicolon separated, UTF-8):
+// code, from, to, capacity, operator, region and the optional INN.
+// Header lines (any line with non numeric code) and empty lines are skipped.
+func Parse(r io.Reader) (*Plan, *ekaerr.Error) {
+	const s = "Failed to parse numbering plan."
+
+	cr := csv.NewReader(r)
+	cr.Comma = ';'
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+
+	var (
+		ranges = make([]numberRange, 0, 1024)
+		// Operator and region are repeated for many ranges. Share them.
+		infos = make(map[Info]*Info)
+	)
+
+	for line := 1; ; line++ {
+		record, legacyErr := cr.Read()
+		if legacyErr == io.EOF {
+			break
+		}
+		if legacyErr != nil {
+			return nil, ekaerr.IllegalFormat.Wrap(legacyErr, s).
+				WithInt("numplan_line", line).
+				Throw()
+		}
+
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		code, legacyErr := strconv.ParseInt(record[0], 10, 64)
+		if legacyErr != nil || len(record) < 6 {
+			continue // header or garbage
+		}
+
+		from, legacyErr1 := strconv.ParseInt(record[1], 10, 64)
+		to, legacyErr2 := strconv.ParseInt(record[2], 10, 64)
+
+		if legacyErr1 != nil || legacyErr2 != nil ||
+			code < 300 || code > 999 || from < 0 || to > 9999999 || from > to {
+			return nil, ekaerr.IllegalFormat.New(s).
+				WithString("description", "Incorrect code or range.").
+				WithInt("numplan_line", line).
+				WithString("numplan_record", strings.Join(record, ";")).
+				Throw()
+		}
+
+		info := Info{
+			Country:  COUNTRY_RU,
+			Operator: record[4],
+			Region:   record[5],
+		}
+		if len(record) > 6 {
+			info.INN = record[6]
+		}
+
+		sharedInfo := infos[info]
+		if sharedInfo == nil {
+			sharedInfo = &info
+			infos[info] = sharedInfo
+		}
+
+		ranges = append(ranges, numberRange{
+			from: code*10_000_000 + from,
+			to:   code*10_000_000 + to,
+			info: sharedInfo,
+		})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from < ranges[j].from
+	})
+
+	return &Plan{ranges: ranges}, nil
+}
+
+// Lookup returns an info about phone number, or false if it's not
+// a Russian number or there is no such number in the numbering plan.
+func (q *Plan) Lookup(number smsenderu_phone.Number) (Info, bool) {
+
+	if q == nil || number.CountryCode() != smsenderu_phone.COUNTRY_CODE_RU {
+		return Info{}, false
+	}
+
+	national, legacyErr := strconv.ParseInt(number.National(), 10, 64)
+	if legacyErr != nil {
+		return Info{}, false
+	}
+
+	// The first range that starts after the number. The previous one is a candidate.
+	i := sort.Search(len(q.ranges), func(i int) bool {
+		return q.ranges[i].from > national
+	})
+
+	if i == 0 || q.ranges[i-1].to < national {
+		return Info{}, false
+	}
+
+	return *q.ranges[i-1].info, true
+}
+
+// LookupString is the same as Lookup() but parses phone number raw at first.
+func (q *Plan) LookupString(raw string) (Info, bool) {
+	number, err := smsenderu_phone.Parse(raw)
+	if err.IsNotNil() {
+		return Info{}, false
+	}
+	return q.Lookup(number)
+}
+
+// Len returns the number of ranges in the numbering plan.
+func (q *Plan) Len() int {
+	if q == nil {
+		return 0
+	}
+	return len(q.ranges)
+}
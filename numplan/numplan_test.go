@@ -0,0 +1,62 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_numplan_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/smsenderu/numplan"
+)
+
+const registry = `АВС/ DEF;От;До;Емкость;Оператор;Регион;ИНН
+912;0000000;0999999;1000000;ПАО "Мобильные ТелеСистемы";Свердловская обл.;7740000076
+912;1000000;1999999;1000000;ПАО "Мобильные ТелеСистемы";Пермский край;7740000076
+495;1230000;1239999;10000;ПАО "МГТС";г. Москва;7710016640
+`
+
+func TestPlan_Lookup(t *testing.T) {
+	plan, err := smsenderu_numplan.Parse(strings.NewReader(registry))
+	require.True(t, err.IsNil())
+	require.EqualValues(t, 3, plan.Len())
+
+	info, ok := plan.LookupString("8 (912) 123-45-67")
+	require.True(t, ok)
+	require.EqualValues(t, "Пермский край", info.Region)
+	require.EqualValues(t, `ПАО "Мобильные ТелеСистемы"`, info.Operator)
+	require.EqualValues(t, smsenderu_numplan.COUNTRY_RU, info.Country)
+
+	info, ok = plan.LookupString("+7 495 123-00-01")
+	require.True(t, ok)
+	require.EqualValues(t, "г. Москва", info.Region)
+
+	_, ok = plan.LookupString("+7 495 124-00-01")
+	require.False(t, ok)
+
+	_, ok = plan.LookupString("+44 20 7946 0958")
+	require.False(t, ok)
+}
+
+func TestPlan_ParseInvalid(t *testing.T) {
+	_, err := smsenderu_numplan.Parse(strings.NewReader("912;0999999;0000000;0;MTS;Region\n"))
+	require.True(t, err.IsNotNil())
+}
+
+func TestDefault(t *testing.T) {
+	require.NotNil(t, smsenderu_numplan.Default())
+
+	plan, err := smsenderu_numplan.Parse(strings.NewReader(registry))
+	require.True(t, err.IsNil())
+
+	smsenderu_numplan.SetDefault(plan)
+	smsenderu_numplan.SetDefault(nil)
+
+	info, ok := smsenderu_numplan.Default().LookupString("+79121234567")
+	require.True(t, ok)
+	require.EqualValues(t, "Пермский край", info.Region)
+}
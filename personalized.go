@@ -0,0 +1,80 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// SEND_EACH_CONCURRENCY is the max number of requests SendEach()
+	// performs at the same time.
+	SEND_EACH_CONCURRENCY = 8
+)
+
+// SendEach sends a message to each recipient of req by its own call of send,
+// performing up to SEND_EACH_CONCURRENCY calls at the same time.
+// It's the fallback for providers that have no native form
+// of personalized messages (SendMessageRequest.Messages).
+//
+// The response follows the Send() contract: one ID and error code per recipient
+// in the same order. If sending to some recipient fails, it gets
+// ERROR_CODE_NOT_SENT error code and the cause in its result, and the response
+// is returned along with an error of PartialFailure class.
+// Only an error is returned if all sendings fail.
+func SendEach(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+	send SendFunc,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to send a message to each recipient."
+
+	recipients := req.AllRecipients()
+	switch {
+
+	case send == nil:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Send function is nil.").
+			Throw()
+
+	case len(recipients) == 0:
+		return send(ctx, req)
+
+	case len(req.Messages) > 0 && len(req.Messages) != len(recipients):
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Messages and recipients have different lengths.").
+			WithInt("recipients", len(recipients)).
+			WithInt("messages", len(req.Messages)).
+			Throw()
+	}
+
+	indexes := make([][]int, len(recipients))
+	subReqs := make([]*SendMessageRequest, len(recipients))
+
+	messages := req.AllMessages()
+	for i, recipient := range recipients {
+		subReq := *req
+		subReq.Recipient, subReq.Recipients = recipient, nil
+		subReq.Message, subReq.Messages = messages[i], nil
+		indexes[i], subReqs[i] = []int{i}, &subReq
+	}
+
+	sendOf := func(int) SendFunc { return send }
+	if resp, err = sendParallel(ctx, len(recipients), indexes, subReqs, SEND_EACH_CONCURRENCY, sendOf, nil); err.IsNotNil() {
+		return resp, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,118 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestSendEach(t *testing.T) {
+	q := smsenderu_mock.New().
+		FailPhone("79000000001", smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER)
+
+	recipients := []string{"79000000000", "79000000001", "79000000002"}
+	messages := []string{"Hello, Ann", "Hello, Bob", "Hello, Eve"}
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Messages:   messages,
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 3)
+	require.EqualValues(t, smsenderu_mock.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[1])
+	require.Empty(t, resp.IDs[1])
+
+	for _, i := range []int{0, 2} {
+		require.EqualValues(t, smsenderu_mock.STATUS_OK, resp.ErrorCodes[i])
+		sent := q.SentTo(recipients[i])
+		require.Len(t, sent, 1)
+		require.EqualValues(t, resp.IDs[i], sent[0].ID)
+		require.EqualValues(t, messages[i], sent[0].Message)
+	}
+}
+
+func TestSendEach_PartialFailure(t *testing.T) {
+	q := smsenderu_mock.New()
+
+	send := func(ctx context.Context, req *smsenderu.SendMessageRequest) (*smsenderu.SendMessageResponse, *ekaerr.Error) {
+		if req.Recipient == "79000000001" {
+			return nil, smsenderu.ProviderUnavailable.New("Request is failed.").Throw()
+		}
+		return q.Send(ctx, req)
+	}
+
+	resp, err := smsenderu.SendEach(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002"},
+		Messages:   []string{"Hello, Ann", "Hello, Bob", "Hello, Eve"},
+	}, send)
+	require.True(t, err.Is(smsenderu.PartialFailure))
+	require.Len(t, resp.IDs, 3)
+	require.NotEmpty(t, resp.IDs[0])
+	require.NotEmpty(t, resp.IDs[2])
+
+	require.Empty(t, resp.IDs[1])
+	require.EqualValues(t, smsenderu.ERROR_CODE_NOT_SENT, resp.ErrorCodes[1])
+	require.EqualValues(t, "79000000001", resp.Results[1].Phone)
+	require.True(t, resp.Results[1].Err.Is(smsenderu.ProviderUnavailable))
+}
+
+func TestSendEach_InvalidLength(t *testing.T) {
+	_, err := smsenderu_mock.New().Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Messages:   []string{"Hello, Ann"},
+	})
+	require.True(t, err.IsNotNil())
+}
+
+func TestFailover_SendPersonalized(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailPhone("79000000001", smsenderu_mock.ERROR_CODE_NOT_ENOUGH_MONEY)
+	secondary := smsenderu_mock.New()
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002"},
+		Messages:   []string{"Hello, Ann", "Hello, Bob", "Hello, Eve"},
+	})
+	require.True(t, err.IsNil())
+	for i := range resp.IDs {
+		require.NotEmpty(t, resp.IDs[i])
+	}
+
+	sent := secondary.SentTo("79000000001")
+	require.Len(t, sent, 1)
+	require.EqualValues(t, "Hello, Bob", sent[0].Message)
+	require.EqualValues(t, "Hello, Eve", primary.SentTo("79000000002")[0].Message)
+}
+
+func TestSendMessageRequest_AllMessages(t *testing.T) {
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+	}
+	require.EqualValues(t, req.Recipients, req.AllRecipients())
+	require.EqualValues(t, []string{"Code: 1234", "Code: 1234"}, req.AllMessages())
+
+	req.Messages = []string{"Code: 1111", "Code: 2222"}
+	require.EqualValues(t, req.Messages, req.AllMessages())
+
+	req = &smsenderu.SendMessageRequest{Recipient: "79000000000", Message: "Code: 1234"}
+	require.EqualValues(t, []string{"79000000000"}, req.AllRecipients())
+	require.EqualValues(t, []string{"Code: 1234"}, req.AllMessages())
+
+	req = nil
+	require.Empty(t, req.AllRecipients())
+	require.Empty(t, req.AllMessages())
+}
@@ -0,0 +1,210 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_phone parses phone numbers written in the common
+// human formats and normalizes them to E.164.
+//
+// Numbers without an international prefix are treated as Russian ones:
+//     8 (912) 345-67-89 -> +79123456789
+//     912 345 67 89     -> +79123456789
+//     +7 912 3456789    -> +79123456789
+//     79123456789       -> +79123456789
+//     00 44 20 7946 0958 -> +442079460958
+package smsenderu_phone
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// Number is a phone number in E.164 format, like "+79123456789".
+	// Use Parse() to get it.
+	Number string
+)
+
+var (
+	// InvalidNumber is the base class of errors Parse() returns.
+	// Use its subclasses to find out why the number is rejected.
+	InvalidNumber = ekaerr.IllegalFormat.NewSubClass("InvalidPhoneNumber")
+
+	// InvalidCharacters means the number contains characters other than digits,
+	// spaces, dashes, dots, parentheses and the leading plus sign.
+	InvalidCharacters = InvalidNumber.NewSubClass("InvalidCharacters")
+
+	// InvalidLength means the number is too short or too long
+	// for its country calling code (or for E.164 in general).
+	InvalidLength = InvalidNumber.NewSubClass("InvalidLength")
+
+	// UnknownCountryCode means the number doesn't start with
+	// an assigned country calling code.
+	UnknownCountryCode = InvalidNumber.NewSubClass("UnknownCountryCode")
+
+	// ImpossibleNumber means the number can't exist within its country's
+	// numbering plan (e.g. Russian number with the area code starting with 0).
+	ImpossibleNumber = InvalidNumber.NewSubClass("ImpossibleNumber")
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// E164_MIN_DIGITS, E164_MAX_DIGITS are the limits of E.164 number's length
+	// (including country calling code, excluding plus sign).
+	E164_MIN_DIGITS = 7
+	E164_MAX_DIGITS = 15
+
+	// COUNTRY_CODE_RU is the country calling code of Russia and Kazakhstan.
+	COUNTRY_CODE_RU = "7"
+)
+
+// Parse parses phone number raw and returns it in E.164 format.
+// If raw is not a valid phone number, an error of InvalidNumber's subclass
+// is returned. The error contains Hash() of raw, not raw itself.
+func Parse(raw string) (Number, *ekaerr.Error) {
+	const s = "Failed to parse phone number."
+
+	digits, hasPlus, ok := digitsOf(raw)
+	switch {
+
+	case !ok:
+		return "", InvalidCharacters.New(s).
+			WithString("description", "Phone number contains forbidden characters.").
+			WithString("phone_raw_hash", Hash(raw)).
+			Throw()
+
+	case hasPlus:
+		// Already in international format.
+
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:] // international call prefix
+
+	case len(digits) == 11 && digits[0] == '8':
+		digits = COUNTRY_CODE_RU + digits[1:] // Russian trunk prefix
+
+	case len(digits) == 10:
+		digits = COUNTRY_CODE_RU + digits // Russian number without trunk prefix
+	}
+
+	if len(digits) < E164_MIN_DIGITS || len(digits) > E164_MAX_DIGITS {
+		return "", InvalidLength.New(s).
+			WithString("description", "Phone number has incorrect length.").
+			WithString("phone_raw_hash", Hash(raw)).
+			WithInt("phone_digits", len(digits)).
+			Throw()
+	}
+
+	countryCode := countryCodeOf(digits)
+	if countryCode == "" {
+		return "", UnknownCountryCode.New(s).
+			WithString("description", "Phone number starts with unknown country calling code.").
+			WithString("phone_raw_hash", Hash(raw)).
+			Throw()
+	}
+
+	if countryCode == COUNTRY_CODE_RU {
+		national := digits[len(countryCode):]
+		switch {
+
+		case len(national) != 10:
+			return "", InvalidLength.New(s).
+				WithString("description", "Russian phone number must have 10 digits after country code.").
+				WithString("phone_raw_hash", Hash(raw)).
+				Throw()
+
+		case strings.IndexByte("0125", national[0]) != -1:
+			return "", ImpossibleNumber.New(s).
+				WithString("description", "Russian phone number's area code can't start with 0, 1, 2 or 5.").
+				WithString("phone_raw_hash", Hash(raw)).
+				Throw()
+		}
+	}
+
+	return Number("+" + digits), nil
+}
+
+// Hash returns a short hex SHA-256 hash of phone number raw, that is attached
+// to errors instead of the phone number itself, since it's a personal data.
+// The same raw phone numbers have the same hashes.
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MustParse is the same as Parse() but panics if raw is not a valid phone number.
+// Use it for constants.
+func MustParse(raw string) Number {
+	n, err := Parse(raw)
+	if err.IsNotNil() {
+		panic("smsenderu_phone: Invalid phone number: " + raw)
+	}
+	return n
+}
+
+// IsValid reports whether raw is a valid phone number.
+func IsValid(raw string) bool {
+	_, err := Parse(raw)
+	return err.IsNil()
+}
+
+// String returns a phone number in E.164 format, like "+79123456789".
+func (n Number) String() string {
+	return string(n)
+}
+
+// Digits returns a phone number in E.164 format without plus sign,
+// like "79123456789".
+func (n Number) Digits() string {
+	return strings.TrimPrefix(string(n), "+")
+}
+
+// CountryCode returns a country calling code of phone number, like "7".
+func (n Number) CountryCode() string {
+	return countryCodeOf(n.Digits())
+}
+
+// National returns a phone number without country calling code,
+// like "9123456789".
+func (n Number) National() string {
+	digits := n.Digits()
+	return digits[len(countryCodeOf(digits)):]
+}
+
+// digitsOf returns only digits of raw phone number, and reports whether
+// it has been started with plus sign. ok is false if raw contains characters
+// other than digits and allowed separators.
+func digitsOf(raw string) (digits string, hasPlus, ok bool) {
+
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "+") {
+		raw, hasPlus = raw[1:], true
+	}
+
+	b := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c >= '0' && c <= '9':
+			b = append(b, c)
+		case c == ' ' || c == '-' || c == '.' || c == '(' || c == ')' || c == '\t':
+		default:
+			return "", false, false
+		}
+	}
+
+	return string(b), hasPlus, len(b) > 0
+}
+
+// countryCodeOf returns a country calling code digits start with,
+// or an empty string if there is no such code. Country calling codes
+// are prefix-free, so the first matched one is the only one.
+func countryCodeOf(digits string) string {
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if _, ok := countryCodes[digits[:n]]; ok {
+			return digits[:n]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_phone_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+	"github.com/qioalice/ekago/v3/ekalog"
+
+	"github.com/qioalice/smsenderu/phone"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected smsenderu_phone.Number
+	}{
+		{"8 (912) 345-67-89", "+79123456789"},
+		{"+7 912 3456789", "+79123456789"},
+		{"79123456789", "+79123456789"},
+		{"912 345 67 89", "+79123456789"},
+		{"  +7(495)123-45-67 ", "+74951234567"},
+		{"00 44 20 7946 0958", "+442079460958"},
+		{"+1 (202) 555-0143", "+12025550143"},
+	}
+	for _, test := range tests {
+		n, err := smsenderu_phone.Parse(test.raw)
+		require.True(t, err.IsNil(), test.raw)
+		require.EqualValues(t, test.expected, n, test.raw)
+	}
+
+	n := smsenderu_phone.MustParse("8 (912) 345-67-89")
+	require.EqualValues(t, "79123456789", n.Digits())
+	require.EqualValues(t, "7", n.CountryCode())
+	require.EqualValues(t, "9123456789", n.National())
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected ekaerr.Class
+	}{
+		{"", smsenderu_phone.InvalidCharacters},
+		{"+7 912 ABC 67 89", smsenderu_phone.InvalidCharacters},
+		{"12345", smsenderu_phone.InvalidLength},
+		{"+7 912 345 67 8", smsenderu_phone.InvalidLength},
+		{"+7 912 345 67 890", smsenderu_phone.InvalidLength},
+		{"+1234567890123456", smsenderu_phone.InvalidLength},
+		{"+28 1234 5678", smsenderu_phone.UnknownCountryCode},
+		{"+7 012 345 67 89", smsenderu_phone.ImpossibleNumber},
+	}
+	for _, test := range tests {
+		_, err := smsenderu_phone.Parse(test.raw)
+		require.True(t, err.Is(test.expected), test.raw)
+		require.True(t, err.IsAnyDeep(smsenderu_phone.InvalidNumber), test.raw)
+		require.False(t, smsenderu_phone.IsValid(test.raw), test.raw)
+	}
+}
+
+func TestParseInvalid_NoRawNumber(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	ekalog.ReplaceIntegrator(new(ekalog.CommonIntegrator).
+		WithEncoder(new(ekalog.CI_JSONEncoder)).
+		WriteTo(b))
+
+	const raw = "+7 012 345 67 89"
+	_, err := smsenderu_phone.Parse(raw)
+	require.True(t, err.IsNotNil())
+
+	ekalog.Errore("", err)
+	require.NotContains(t, b.String(), raw)
+	require.Contains(t, b.String(), smsenderu_phone.Hash(raw))
+	require.EqualValues(t, smsenderu_phone.Hash(raw), smsenderu_phone.Hash(raw))
+	require.NotEqual(t, smsenderu_phone.Hash(raw), smsenderu_phone.Hash("+7 012 345 67 88"))
+}
@@ -0,0 +1,301 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu/phone"
+)
+
+type (
+	// Rate is a token bucket's limit: no more than Count messages per Per duration
+	// with bursts up to Burst messages (Count if Burst is not positive).
+	// Zero Rate means no limit.
+	Rate struct {
+		Count int
+		Per   time.Duration
+		Burst int
+	}
+
+	// RateLimits is a set of limits of RateLimit() middleware.
+	// Each limit counts messages, one per each recipient of SendMessageRequest.
+	RateLimits struct {
+
+		// Global limits all messages.
+		Global Rate
+
+		// PerRecipient limits messages to the same phone number.
+		PerRecipient Rate
+
+		// PerText limits messages with the same text.
+		PerText Rate
+
+		// PerUserIP limits messages with the same SendMessageRequest.UserIP.
+		// Requests without UserIP are not limited.
+		PerUserIP Rate
+	}
+
+	rateLimiter struct {
+		limits RateLimits
+
+		mu          sync.Mutex
+		global      *tokenBucket
+		byRecipient map[string]*tokenBucket
+		byText      map[string]*tokenBucket
+		byUserIP    map[string]*tokenBucket
+		calls       int
+	}
+
+	// tokenBucket is the token bucket of Rate. Not safe for concurrent use.
+	tokenBucket struct {
+		tokens  float64
+		updated time.Time
+	}
+)
+
+var (
+	// RateLimited is the base class of errors returned by RateLimit() middleware
+	// when one of the limits is exceeded.
+	// Use IsAnyDeep() to check it, or its subclasses to find out which limit is hit.
+	RateLimited = ekaerr.RejectedOperation.NewSubClass("RateLimited")
+
+	RateLimitedGlobal    = RateLimited.NewSubClass("Global")
+	RateLimitedRecipient = RateLimited.NewSubClass("Recipient")
+	RateLimitedText      = RateLimited.NewSubClass("Text")
+	RateLimitedUserIP    = RateLimited.NewSubClass("UserIP")
+)
+
+// rateLimiterSweepEvery is how often (in Send() calls) the full (unused)
+// token buckets are removed.
+const rateLimiterSweepEvery = 1024
+
+// NewRateLimiter returns a Sender that limits the rate of messages
+// sent using sender, according to limits. It's a shorthand for
+// Chain(sender, RateLimit(limits)).
+func NewRateLimiter(sender Sender, limits RateLimits) Sender {
+	return Chain(sender, RateLimit(limits))
+}
+
+// RateLimit returns a Middleware that limits the rate of messages
+// according to limits. The limits are checked locally before the request is sent,
+// and if one of them is exceeded, Send() returns an error of the RateLimited's
+// subclass that identifies the limit (RateLimitedGlobal, RateLimitedRecipient,
+// RateLimitedText, RateLimitedUserIP) and nothing is sent.
+// Tokens are consumed only if all limits allow the request.
+// A request with more messages than the burst of some limit never passes it,
+// so an error of ekaerr.IllegalArgument class is returned for it instead.
+// Phone numbers are normalized (see smsenderu_phone.Parse()), so the different
+// forms of the same number share PerRecipient limit.
+//
+// Other methods are not limited. The middleware is safe for concurrent use,
+// and its limits are shared between all Senders it's applied to.
+func RateLimit(limits RateLimits) Middleware {
+
+	q := &rateLimiter{
+		limits:      limits,
+		byRecipient: make(map[string]*tokenBucket),
+		byText:      make(map[string]*tokenBucket),
+		byUserIP:    make(map[string]*tokenBucket),
+	}
+
+	return Middleware{
+		Send: func(next SendFunc) SendFunc {
+			return func(ctx context.Context, req *SendMessageRequest) (*SendMessageResponse, *ekaerr.Error) {
+				const s = "RateLimiter: Failed to send a message(s)."
+				if err := q.take(req, time.Now()); err.IsNotNil() {
+					return nil, err.
+						AddMessage(s).
+						Throw()
+				}
+				return next(ctx, req)
+			}
+		},
+	}
+}
+
+// take consumes the tokens of all limits for the messages of req
+// if all limits allow it, or returns an error of the first exceeded limit.
+func (q *rateLimiter) take(req *SendMessageRequest, now time.Time) *ekaerr.Error {
+	const s = "Rate limit is exceeded."
+
+	recipients := req.AllRecipients()
+	if len(recipients) == 0 {
+		return nil // let the Sender report about invalid request
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.calls++; q.calls%rateLimiterSweepEvery == 0 {
+		q.sweep(now)
+	}
+
+	type (
+		take struct {
+			bucket *tokenBucket
+			rate   Rate
+			n      float64
+			cls    ekaerr.Class
+			key    string
+		}
+	)
+
+	takes := make([]take, 0, len(recipients)+3)
+
+	if q.limits.Global.isLimited() {
+		if q.global == nil {
+			q.global = newTokenBucket(q.limits.Global, now)
+		}
+		takes = append(takes, take{q.global, q.limits.Global, float64(len(recipients)), RateLimitedGlobal, ""})
+	}
+
+	if q.limits.PerRecipient.isLimited() {
+		n := make(map[string]float64, len(recipients))
+		for _, recipient := range recipients {
+			n[recipientKeyOf(recipient)]++
+		}
+		for recipient, n := range n {
+			bucket := bucketOf(q.byRecipient, recipient, q.limits.PerRecipient, now)
+			takes = append(takes, take{bucket, q.limits.PerRecipient, n, RateLimitedRecipient, recipient})
+		}
+	}
+
+	if q.limits.PerText.isLimited() {
+		n := make(map[string]float64, 1)
+		for _, message := range req.AllMessages() {
+			n[message]++
+		}
+		for text, n := range n {
+			bucket := bucketOf(q.byText, text, q.limits.PerText, now)
+			takes = append(takes, take{bucket, q.limits.PerText, n, RateLimitedText, text})
+		}
+	}
+
+	if q.limits.PerUserIP.isLimited() && req.UserIP != "" {
+		bucket := bucketOf(q.byUserIP, req.UserIP, q.limits.PerUserIP, now)
+		takes = append(takes, take{bucket, q.limits.PerUserIP, float64(len(recipients)), RateLimitedUserIP, req.UserIP})
+	}
+
+	// The keys are phone numbers and message texts (e.g. one-time passwords),
+	// so only their hashes are attached to errors.
+	for _, take := range takes {
+		switch {
+
+		case take.n > take.rate.burst():
+			return ekaerr.IllegalArgument.New(s).
+				WithString("description", "Request has more messages than the limit's burst, it can never be sent.").
+				WithString("rate_limit", take.cls.Name()).
+				WithString("rate_limit_key_hash", keyHashOf(take.key)).
+				WithInt("rate_limit_burst", int(take.rate.burst())).
+				WithInt("rate_limit_messages", int(take.n)).
+				Throw()
+
+		case !take.bucket.allows(take.rate, take.n, now):
+			return take.cls.New(s).
+				WithString("description", "Request is rejected locally, nothing is sent.").
+				WithString("rate_limit", take.cls.Name()).
+				WithString("rate_limit_key_hash", keyHashOf(take.key)).
+				WithInt("rate_limit_count", take.rate.Count).
+				WithDuration("rate_limit_per", take.rate.Per).
+				Throw()
+		}
+	}
+
+	for _, take := range takes {
+		take.bucket.tokens -= take.n
+	}
+
+	return nil
+}
+
+// recipientKeyOf returns the key of PerRecipient limit of the phone number,
+// the same for all forms of the same number. Invalid phone number is a key itself.
+func recipientKeyOf(recipient string) string {
+	if number, err := smsenderu_phone.Parse(recipient); err.IsNil() {
+		return number.String()
+	}
+	return recipient
+}
+
+// keyHashOf returns a short hex SHA-256 hash of the limit's key,
+// or an empty string for the empty key (Global limit).
+func keyHashOf(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sweep removes the full token buckets, since they are the same as new ones.
+func (q *rateLimiter) sweep(now time.Time) {
+	for _, sweep := range []struct {
+		buckets map[string]*tokenBucket
+		rate    Rate
+	}{
+		{q.byRecipient, q.limits.PerRecipient},
+		{q.byText, q.limits.PerText},
+		{q.byUserIP, q.limits.PerUserIP},
+	} {
+		for key, bucket := range sweep.buckets {
+			if bucket.refill(sweep.rate, now); bucket.tokens >= sweep.rate.burst() {
+				delete(sweep.buckets, key)
+			}
+		}
+	}
+}
+
+// isLimited reports whether Rate is a limit at all.
+func (r Rate) isLimited() bool {
+	return r.Count > 0 && r.Per > 0
+}
+
+// burst returns the max number of tokens in the bucket.
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Count)
+}
+
+// newTokenBucket returns a new full token bucket of rate.
+func newTokenBucket(rate Rate, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: rate.burst(), updated: now}
+}
+
+// bucketOf returns the token bucket of key, creating it if it's necessary.
+func bucketOf(buckets map[string]*tokenBucket, key string, rate Rate, now time.Time) *tokenBucket {
+	bucket := buckets[key]
+	if bucket == nil {
+		bucket = newTokenBucket(rate, now)
+		buckets[key] = bucket
+	}
+	return bucket
+}
+
+// refill adds the tokens accumulated since the last update.
+func (q *tokenBucket) refill(rate Rate, now time.Time) {
+	if elapsed := now.Sub(q.updated); elapsed > 0 {
+		q.tokens += float64(rate.Count) * float64(elapsed) / float64(rate.Per)
+		if burst := rate.burst(); q.tokens > burst {
+			q.tokens = burst
+		}
+		q.updated = now
+	}
+}
+
+// allows refills the bucket and reports whether it has n tokens.
+func (q *tokenBucket) allows(rate Rate, n float64, now time.Time) bool {
+	q.refill(rate, now)
+	return q.tokens >= n
+}
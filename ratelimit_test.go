@@ -0,0 +1,125 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestRateLimiter_PerRecipient(t *testing.T) {
+	sender := smsenderu_mock.New()
+	q := smsenderu.NewRateLimiter(sender, smsenderu.RateLimits{
+		PerRecipient: smsenderu.Rate{Count: 1, Per: time.Hour},
+	})
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000001", "+7 900 000-00-00"},
+		Message:    "Code: 5678",
+	})
+	require.True(t, err.Is(smsenderu.RateLimitedRecipient))
+	require.True(t, err.IsAnyDeep(smsenderu.RateLimited))
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "8 (900) 000-00-00",
+		Message:   "Code: 5678",
+	})
+	require.True(t, err.Is(smsenderu.RateLimitedRecipient), "Phone number must be normalized")
+
+	// Tokens of 79000000001 must not be consumed by the rejected request.
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: "79000000001",
+		Message:   "Code: 5678",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, sender.Sent(), 2)
+}
+
+func TestRateLimiter_PerTextAndUserIP(t *testing.T) {
+	q := smsenderu.NewRateLimiter(smsenderu_mock.New(), smsenderu.RateLimits{
+		PerText:   smsenderu.Rate{Count: 2, Per: time.Hour},
+		PerUserIP: smsenderu.Rate{Count: 1, Per: time.Hour},
+	})
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Hello",
+	}
+
+	_, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.Is(smsenderu.RateLimitedText))
+
+	req = &smsenderu.SendMessageRequest{Recipient: "79000000000", Message: "Code", UserIP: "10.0.0.1"}
+
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.Is(smsenderu.RateLimitedUserIP))
+}
+
+func TestRateLimiter_MoreThanBurst(t *testing.T) {
+	sender := smsenderu_mock.New()
+	q := smsenderu.NewRateLimiter(sender, smsenderu.RateLimits{
+		Global: smsenderu.Rate{Count: 10, Per: time.Minute, Burst: 2},
+	})
+
+	// Such request never passes the limit, so it's not a retryable rate limit error.
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.False(t, err.IsAnyDeep(smsenderu.RateLimited))
+	require.Empty(t, sender.Sent())
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+}
+
+func TestRateLimiter_GlobalConcurrent(t *testing.T) {
+	sender := smsenderu_mock.New().SetBalance(decimal.NewFromInt(1000), "RUB")
+	q := smsenderu.NewRateLimiter(sender, smsenderu.RateLimits{
+		Global: smsenderu.Rate{Count: 10, Per: time.Hour},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+				Recipient: "79000000000",
+				Message:   "Code: 1234",
+			})
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, sender.Sent(), 10)
+}
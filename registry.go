@@ -0,0 +1,222 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// Driver is an API provider's constructor of Senders.
+	// Providers register their Drivers using Register(), usually at the init(),
+	// and then applications might create Senders using Open() or OpenConfig(),
+	// switching providers via configuration only.
+	Driver interface {
+
+		// Open must return a new Sender that is configured using provided Config.
+		// Config's Params that are not supported by the Driver must be reported
+		// as an error.
+		Open(cfg *Config) (Sender, *ekaerr.Error)
+	}
+
+	// DriverFunc is an adapter to allow the use of ordinary function as a Driver.
+	DriverFunc func(cfg *Config) (Sender, *ekaerr.Error)
+
+	// Config is a provider independent configuration of Sender.
+	// It might be parsed from the connection string using ParseDSN().
+	Config struct {
+
+		// Driver is a name of Driver that has been used at the Register().
+		Driver string
+
+		// Token is an API token (or API login) of the provider's account.
+		Token string
+
+		// Timeout is the max duration of each Sender's method call.
+		// Zero means no timeout.
+		Timeout time.Duration
+
+		// From is a default sender that is used
+		// if SendMessageRequest.From is not presented.
+		From string
+
+		// BaseURL overrides provider's API base URL if presented.
+		BaseURL string
+
+		// Params is a set of the Driver specific parameters.
+		Params map[string]string
+	}
+)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]Driver)
+)
+
+func (f DriverFunc) Open(cfg *Config) (Sender, *ekaerr.Error) {
+	return f(cfg)
+}
+
+// Register makes a Driver available by the provided name.
+// If Register is called twice with the same name or if driver is nil, it panics.
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "":
+		panic("smsenderu: Register driver with empty name")
+	case driver == nil:
+		panic("smsenderu: Register driver is nil")
+	}
+
+	if _, dup := drivers[name]; dup {
+		panic("smsenderu: Register called twice for driver " + name)
+	}
+
+	drivers[name] = driver
+}
+
+// Drivers returns a sorted list of the names of the registered Drivers.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Open creates a new Sender using the connection string dsn.
+// See ParseDSN() for the format of dsn.
+//
+// Don't forget to import the provider's package to register its Driver:
+//     import _ "github.com/qioalice/smsenderu/services/sms.ru"
+func Open(dsn string) (Sender, *ekaerr.Error) {
+	const s = "Failed to open Sender using connection string."
+
+	cfg, err := ParseDSN(dsn)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	sender, err := OpenConfig(*cfg)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return sender, nil
+}
+
+// OpenConfig creates a new Sender using Driver with the Config.Driver name.
+func OpenConfig(cfg Config) (Sender, *ekaerr.Error) {
+	const s = "Failed to open Sender using config."
+
+	cfg.Driver = strings.ToLower(strings.TrimSpace(cfg.Driver))
+
+	driversMu.RLock()
+	driver, ok := drivers[cfg.Driver]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Unknown driver. Did you forget to import the provider's package?").
+			WithString("driver", cfg.Driver).
+			WithString("drivers_registered", strings.Join(Drivers(), ",")).
+			Throw()
+	}
+
+	sender, err := driver.Open(&cfg)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			WithString("driver", cfg.Driver).
+			Throw()
+	}
+
+	return sender, nil
+}
+
+// ParseDSN parses the connection string dsn and returns a Config.
+//
+// The format is:
+//     driver://TOKEN?timeout=5s&from=MyShop&base_url=https://...&param=value
+//
+// The token might be passed also as a user info (driver://TOKEN@host)
+// in which case a host is ignored. Query parameters "timeout", "from"
+// and "base_url" are mapped to the Config's fields, others are placed to Params.
+func ParseDSN(dsn string) (*Config, *ekaerr.Error) {
+	const s = "Failed to parse Sender's connection string."
+
+	u, legacyErr := url.Parse(strings.TrimSpace(dsn))
+	if legacyErr != nil {
+		// The connection string contains the token, never attach it.
+		return nil, ekaerr.IllegalFormat.Wrap(unwrapURLError(legacyErr), s).
+			Throw()
+	}
+
+	if u.Scheme == "" {
+		return nil, ekaerr.IllegalFormat.New(s).
+			WithString("description", "Driver name is not provided. Expected: driver://TOKEN?params.").
+			Throw()
+	}
+
+	cfg := &Config{
+		Driver: u.Scheme,
+		Token:  u.Host,
+	}
+
+	if u.User != nil {
+		cfg.Token = u.User.Username()
+	}
+
+	for key, values := range u.Query() {
+		value := ""
+		if len(values) > 0 {
+			value = values[len(values)-1]
+		}
+
+		switch key {
+
+		case "timeout":
+			if cfg.Timeout, legacyErr = time.ParseDuration(value); legacyErr != nil {
+				return nil, ekaerr.IllegalFormat.Wrap(legacyErr, s).
+					WithString("description", "Incorrect timeout value.").
+					WithString("timeout", value).
+					Throw()
+			}
+
+		case "from":
+			cfg.From = value
+
+		case "base_url":
+			cfg.BaseURL = value
+
+		default:
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[key] = value
+		}
+	}
+
+	return cfg, nil
+}
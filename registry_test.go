@@ -0,0 +1,67 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+	"github.com/qioalice/ekago/v3/ekalog"
+
+	"github.com/qioalice/smsenderu"
+)
+
+func TestParseDSN(t *testing.T) {
+	cfg, err := smsenderu.ParseDSN("smsru://ABCD-1234?timeout=5s&from=MyShop&max_conns=10")
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "smsru", cfg.Driver)
+	require.EqualValues(t, "ABCD-1234", cfg.Token)
+	require.EqualValues(t, 5*time.Second, cfg.Timeout)
+	require.EqualValues(t, "MyShop", cfg.From)
+	require.EqualValues(t, map[string]string{"max_conns": "10"}, cfg.Params)
+
+	cfg, err = smsenderu.ParseDSN("smsru://ABCD-1234@localhost")
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "ABCD-1234", cfg.Token)
+
+	_, err = smsenderu.ParseDSN("ABCD-1234")
+	require.True(t, err.Is(ekaerr.IllegalFormat))
+
+	_, err = smsenderu.ParseDSN("smsru://ABCD-1234?timeout=5")
+	require.True(t, err.Is(ekaerr.IllegalFormat))
+}
+
+func TestParseDSN_NoSecrets(t *testing.T) {
+	b := bytes.NewBuffer(nil)
+	ekalog.ReplaceIntegrator(new(ekalog.CommonIntegrator).
+		WithEncoder(new(ekalog.CI_JSONEncoder)).
+		WriteTo(b))
+
+	_, err := smsenderu.Open("smsru://SECRET-TOKEN-1234%zz?from=MyShop")
+	require.True(t, err.Is(ekaerr.IllegalFormat))
+
+	ekalog.Errore("", err)
+	require.Contains(t, b.String(), "invalid URL escape")
+	require.NotContains(t, b.String(), "SECRET-TOKEN-1234")
+}
+
+func TestOpenConfig_UnknownDriver(t *testing.T) {
+	_, err := smsenderu.OpenConfig(smsenderu.Config{Driver: "unknown"})
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+}
+
+func TestRegister(t *testing.T) {
+	driver := smsenderu.DriverFunc(func(cfg *smsenderu.Config) (smsenderu.Sender, *ekaerr.Error) {
+		return nil, nil
+	})
+	smsenderu.Register("test_register", driver)
+	require.Contains(t, smsenderu.Drivers(), "test_register")
+	require.Panics(t, func() { smsenderu.Register("test_register", driver) })
+}
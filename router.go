@@ -0,0 +1,638 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu/phone"
+)
+
+type (
+	// Router is a composite Sender that spreads the recipients of each request
+	// over its backends (other Senders) using RouterStrategy.
+	// It's safe for concurrent use.
+	//
+	// IDs of sent messages are prefixed by the index of backend that has sent them
+	// (see ComposeMessageID()), so Status() routes the ID back to that backend,
+	// and BackendOf() tells its name.
+	//
+	// If a backend fails to send a message, its recipients get ERROR_CODE_NOT_SENT
+	// error code and the cause in their results, and Send() returns
+	// the response along with an error of PartialFailure class.
+	// Only an error is returned if all backends fail.
+	Router struct {
+		strategy RouterStrategy
+		backends []RouterBackend
+
+		mu             sync.Mutex
+		currentWeights []int
+	}
+
+	// RouterBackend is a Sender the Router uses to send messages.
+	RouterBackend struct {
+
+		// Name is a human readable name of backend, like "smsru-main".
+		Name string
+
+		// Sender is a backend itself. Required.
+		Sender Sender
+
+		// Weight is a relative share of recipients the backend gets
+		// using ROUTER_STRATEGY_WEIGHTED. Treated as 1 if it's not positive.
+		Weight int
+
+		// Prefixes are the recipient's phone number prefixes
+		// (E.164 digits without plus sign, like "7" or "7912") the backend
+		// is used for using ROUTER_STRATEGY_PREFIX. Recipients are normalized
+		// before matching (see smsenderu_phone.Parse()), so "8 (912) ..." matches "7912".
+		// Only digits of prefixes are used, so "+7 912" is the same as "7912".
+		// The longest matched prefix wins.
+		Prefixes []string
+
+		// Account is an identifier of provider's account the backend uses,
+		// like "smsru:login". Balance() and BalanceIn() count the balance
+		// of backends with the same non-empty Account only once.
+		Account string
+	}
+
+	// RouterStrategy is the way Router chooses a backend for each recipient.
+	RouterStrategy uint8
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// ROUTER_STRATEGY_WEIGHTED spreads recipients over backends
+	// proportionally to their weights (smooth weighted round-robin).
+	ROUTER_STRATEGY_WEIGHTED RouterStrategy = iota
+
+	// ROUTER_STRATEGY_PREFIX chooses a backend by the longest matched
+	// phone number's prefix. ROUTER_STRATEGY_WEIGHTED is used for recipients
+	// that are not matched by any prefix.
+	ROUTER_STRATEGY_PREFIX
+
+	// ROUTER_STRATEGY_CHEAPEST calls Cost() of each backend and chooses
+	// the cheapest one for each recipient. If backend does not support
+	// per recipient costs, the average cost is used.
+	ROUTER_STRATEGY_CHEAPEST
+)
+
+// NewRouter returns a new Router that uses provided strategy
+// to spread recipients over the provided backends.
+// Backends with nil Sender are ignored.
+func NewRouter(strategy RouterStrategy, backends ...RouterBackend) *Router {
+
+	filtered := make([]RouterBackend, 0, len(backends))
+	for _, backend := range backends {
+		if backend.Sender == nil {
+			continue
+		}
+		if backend.Weight <= 0 {
+			backend.Weight = 1
+		}
+		backend.Prefixes = normalizedPrefixes(backend.Prefixes)
+		filtered = append(filtered, backend)
+	}
+
+	return &Router{
+		strategy:       strategy,
+		backends:       filtered,
+		currentWeights: make([]int, len(filtered)),
+	}
+}
+
+// Route returns the indexes of backends each recipient of the request
+// would be sent by, in the same order as the request's recipients.
+//
+// It's a preview, it doesn't change the state of ROUTER_STRATEGY_WEIGHTED,
+// so the next Send() of the same request uses the same backends
+// unless other requests are sent between them (or the costs are changed
+// using ROUTER_STRATEGY_CHEAPEST).
+func (q *Router) Route(ctx context.Context, req *SendMessageRequest) ([]int, *ekaerr.Error) {
+	const s = "Router: Failed to route a message(s)."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	route, err := q.route(ctx, req, false)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return route, nil
+}
+
+// BackendOf returns the name of backend that has sent the message
+// with provided ID, or an empty string if ID has not been issued by Router.
+func (q *Router) BackendOf(sentSmsId string) string {
+	if idx, _, ok := ParseMessageID(sentSmsId); ok && q != nil && idx < len(q.backends) {
+		return q.backends[idx].Name
+	}
+	return ""
+}
+
+// Check checks all backends and returns the first error.
+func (q *Router) Check(ctx context.Context) *ekaerr.Error {
+	const s = "Router: Failed to check backends."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return err.
+			Throw()
+	}
+
+	for _, backend := range q.backends {
+		if err := backend.Sender.Check(ctx); err.IsNotNil() {
+			return err.
+				AddMessage(s).
+				WithString("router_backend", backend.Name).
+				Throw()
+		}
+	}
+
+	return nil
+}
+
+// Balance returns the sum of backends' balances.
+// The balance of backends with the same Account is counted once.
+// All backends must have the same currency.
+func (q *Router) Balance(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error) {
+	const s = "Router: Failed to get balance."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, "", err.
+			Throw()
+	}
+
+	total, currency := decimal.Zero, ""
+	for _, backend := range q.backendsByAccount() {
+
+		balance, backendCurrency, err := backend.Sender.Balance(ctx)
+		if err.IsNotNil() {
+			return decimal.Zero, "", err.
+				AddMessage(s).
+				WithString("router_backend", backend.Name).
+				Throw()
+		}
+
+		if currency != "" && currency != backendCurrency {
+			return decimal.Zero, "", ekaerr.IllegalState.New(s).
+				WithString("description", "Backends have different currencies. Use BalanceIn() instead.").
+				WithString("router_backend", backend.Name).
+				WithString("router_currency", currency).
+				WithString("router_backend_currency", backendCurrency).
+				Throw()
+		}
+
+		total, currency = total.Add(balance), backendCurrency
+	}
+
+	return total, currency, nil
+}
+
+// BalanceIn returns the sum of backends' balances in the provided currency.
+// The balance of backends with the same Account is counted once.
+func (q *Router) BalanceIn(ctx context.Context, currency string) (decimal.Decimal, *ekaerr.Error) {
+	const s = "Router: Failed to get balance in the specified currency."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return decimal.Zero, err.
+			Throw()
+	}
+
+	total := decimal.Zero
+	for _, backend := range q.backendsByAccount() {
+		balance, err := backend.Sender.BalanceIn(ctx, currency)
+		if err.IsNotNil() {
+			return decimal.Zero, err.
+				AddMessage(s).
+				WithString("router_backend", backend.Name).
+				Throw()
+		}
+		total = total.Add(balance)
+	}
+
+	return total, nil
+}
+
+// Senders returns the sorted union of backends' senders.
+func (q *Router) Senders(ctx context.Context) ([]string, *ekaerr.Error) {
+	const s = "Router: Failed to get registered senders."
+
+	if err := q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	union := make(map[string]struct{})
+	for _, backend := range q.backends {
+		senders, err := backend.Sender.Senders(ctx)
+		if err.IsNotNil() {
+			return nil, err.
+				AddMessage(s).
+				WithString("router_backend", backend.Name).
+				Throw()
+		}
+		for _, sender := range senders {
+			union[sender] = struct{}{}
+		}
+	}
+
+	if len(union) == 0 {
+		return nil, nil
+	}
+
+	senders := make([]string, 0, len(union))
+	for sender := range union {
+		senders = append(senders, sender)
+	}
+
+	sort.Strings(senders)
+	return senders, nil
+}
+
+func (q *Router) Send(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *SendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Router: Failed to send a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	recipients := req.AllRecipients()
+	if len(recipients) == 0 {
+		return q.backends[0].Sender.Send(ctx, req)
+	}
+
+	route, err := q.route(ctx, req, true)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	var (
+		backendIdxs []int
+		indexes     [][]int
+		subReqs     []*SendMessageRequest
+	)
+
+	for idx, group := range groupByRoute(route, len(q.backends)) {
+		if len(group) > 0 {
+			backendIdxs = append(backendIdxs, idx)
+			indexes = append(indexes, group)
+			subReqs = append(subReqs, subRequest(req, recipients, group))
+		}
+	}
+
+	sendOf := func(i int) SendFunc {
+		backend := q.backends[backendIdxs[i]]
+		return func(ctx context.Context, subReq *SendMessageRequest) (*SendMessageResponse, *ekaerr.Error) {
+			subResp, err := backend.Sender.Send(ctx, subReq)
+			if err.IsNotNil() {
+				err = err.WithString("router_backend", backend.Name)
+			}
+			return subResp, err
+		}
+	}
+
+	composeID := func(i int, id string) string {
+		return ComposeMessageID(backendIdxs[i], id)
+	}
+
+	resp, err = sendParallel(ctx, len(recipients), indexes, subReqs, len(subReqs), sendOf, composeID)
+	if err.IsNotNil() {
+		return resp, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+func (q *Router) Cost(
+
+	ctx context.Context,
+	req *SendMessageRequest,
+) (
+	resp *CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Router: Failed to get an info about cost of sending a message(s)."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	recipients := req.AllRecipients()
+	if len(recipients) == 0 {
+		return q.backends[0].Sender.Cost(ctx, req)
+	}
+
+	route, err := q.route(ctx, req, false)
+	if err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	resp = newCostResponse(len(recipients))
+
+	for idx, group := range groupByRoute(route, len(q.backends)) {
+		if len(group) == 0 {
+			continue
+		}
+
+		subResp, err := q.backends[idx].Sender.Cost(ctx, subRequest(req, recipients, group))
+		if err.IsNotNil() {
+			return nil, err.
+				AddMessage(s).
+				WithString("router_backend", q.backends[idx].Name).
+				Throw()
+		}
+
+		mergeCostResponse(resp, subResp, group)
+	}
+
+	return resp, nil
+}
+
+func (q *Router) Status(
+
+	ctx context.Context,
+	sentSmsId string,
+) (
+	resp *StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Router: Failed to get an info about message."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	idx, id, ok := ParseMessageID(sentSmsId)
+	if !ok || idx >= len(q.backends) {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "SMS ID has not been issued by this Sender.").
+			WithString("sms_id", sentSmsId).
+			Throw()
+	}
+
+	if resp, err = q.backends[idx].Sender.Status(ctx, id); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			WithString("router_backend", q.backends[idx].Name).
+			Throw()
+	}
+
+	resp.ID = sentSmsId
+	return resp, nil
+}
+
+// StatusBatch implements StatusBatcher. See StatusBatch() for the details.
+func (q *Router) StatusBatch(
+
+	ctx context.Context,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Router: Failed to get an info about messages."
+
+	if err = q.validate(s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	senders := make([]Sender, len(q.backends))
+	for i, backend := range q.backends {
+		senders[i] = backend.Sender
+	}
+
+	if resp, err = statusBatchComposite(ctx, senders, sentSmsIds); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// validate returns an error if Router is not initialized properly.
+func (q *Router) validate(message string) *ekaerr.Error {
+	switch {
+
+	case q == nil:
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "Invalid sender object. Did you use NewRouter() constructor correctly?").
+			Throw()
+
+	case len(q.backends) == 0:
+		return ekaerr.IllegalArgument.New(message).
+			WithString("description", "No backends are provided.").
+			Throw()
+	}
+
+	return nil
+}
+
+// route returns the indexes of backends each recipient of the request
+// is sent by. The state of ROUTER_STRATEGY_WEIGHTED is changed only if commit is true.
+func (q *Router) route(ctx context.Context, req *SendMessageRequest, commit bool) ([]int, *ekaerr.Error) {
+
+	recipients := req.AllRecipients()
+	route := make([]int, len(recipients))
+
+	if q.strategy == ROUTER_STRATEGY_CHEAPEST {
+		if err := q.routeByCost(ctx, req, route); err.IsNotNil() {
+			return nil, err.
+				Throw()
+		}
+		return route, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	weights := q.currentWeights
+	if !commit {
+		weights = append([]int(nil), weights...)
+	}
+
+	for i, recipient := range recipients {
+		route[i] = -1
+		if q.strategy == ROUTER_STRATEGY_PREFIX {
+			route[i] = q.routeByPrefix(recipient)
+		}
+		if route[i] == -1 {
+			route[i] = q.routeByWeight(weights)
+		}
+	}
+
+	return route, nil
+}
+
+// routeByWeight returns the index of the next backend using
+// smooth weighted round-robin algorithm with provided current weights.
+func (q *Router) routeByWeight(currentWeights []int) int {
+
+	best, total := -1, 0
+	for i, backend := range q.backends {
+		currentWeights[i] += backend.Weight
+		total += backend.Weight
+		if best == -1 || currentWeights[i] > currentWeights[best] {
+			best = i
+		}
+	}
+
+	currentWeights[best] -= total
+	return best
+}
+
+// routeByPrefix returns the index of backend with the longest prefix
+// the recipient's phone number starts with, or -1 if there is no such backend
+// or the phone number is invalid.
+func (q *Router) routeByPrefix(recipient string) int {
+
+	number, err := smsenderu_phone.Parse(recipient)
+	if err.IsNotNil() {
+		return -1
+	}
+	digits := number.Digits()
+
+	best, bestLen := -1, 0
+	for i, backend := range q.backends {
+		for _, prefix := range backend.Prefixes {
+			if len(prefix) > bestLen && strings.HasPrefix(digits, prefix) {
+				best, bestLen = i, len(prefix)
+			}
+		}
+	}
+
+	return best
+}
+
+// normalizedPrefixes returns the digits of each phone number's prefix
+// skipping the ones that have no digits at all.
+func normalizedPrefixes(prefixes []string) []string {
+	normalized := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, prefix)
+		if digits != "" {
+			normalized = append(normalized, digits)
+		}
+	}
+	return normalized
+}
+
+// routeByCost fills route with the indexes of the cheapest backends
+// for each recipient. Backends that fail to report the cost are skipped.
+func (q *Router) routeByCost(ctx context.Context, req *SendMessageRequest, route []int) *ekaerr.Error {
+
+	costs := make([]decimal.Decimal, len(route))
+	for i := range route {
+		route[i] = -1
+	}
+
+	var (
+		lastErr   *ekaerr.Error
+		responded = -1
+	)
+
+	for idx, backend := range q.backends {
+
+		resp, err := backend.Sender.Cost(ctx, req)
+		if err.IsNotNil() {
+			lastErr = err.WithString("router_backend", backend.Name)
+			continue
+		}
+
+		if responded == -1 {
+			responded = idx
+		}
+
+		for i := range route {
+			// The cost is not calculated for the recipient (e.g. phone number is invalid).
+			if len(resp.ErrorCodes) == len(route) && resp.ErrorCodes[i] != 0 {
+				continue
+			}
+			cost := resp.Total.Div(decimal.NewFromInt(int64(len(route))))
+			if len(resp.Costs) == len(route) {
+				cost = resp.Costs[i]
+			}
+			if route[i] == -1 || cost.LessThan(costs[i]) {
+				route[i], costs[i] = idx, cost
+			}
+		}
+	}
+
+	if responded == -1 {
+		return lastErr.
+			Throw()
+	}
+
+	// Recipients no backend calculates the cost for (e.g. invalid phone numbers)
+	// are sent by the first backend that has responded, it reports their error codes.
+	for i := range route {
+		if route[i] == -1 {
+			route[i] = responded
+		}
+	}
+
+	return nil
+}
+
+// backendsByAccount returns backends without the ones
+// that have the same non-empty Account as some previous backend.
+func (q *Router) backendsByAccount() []RouterBackend {
+	backends := make([]RouterBackend, 0, len(q.backends))
+	accounts := make(map[string]struct{}, len(q.backends))
+	for _, backend := range q.backends {
+		if backend.Account != "" {
+			if _, seen := accounts[backend.Account]; seen {
+				continue
+			}
+			accounts[backend.Account] = struct{}{}
+		}
+		backends = append(backends, backend)
+	}
+	return backends
+}
+
+// groupByRoute returns the indexes of recipients grouped by the backends.
+func groupByRoute(route []int, n int) [][]int {
+	groups := make([][]int, n)
+	for i, idx := range route {
+		groups[idx] = append(groups[idx], i)
+	}
+	return groups
+}
@@ -0,0 +1,161 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestRouter_Weighted(t *testing.T) {
+	a, b := smsenderu_mock.New(), smsenderu_mock.New()
+
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_WEIGHTED,
+		smsenderu.RouterBackend{Name: "a", Sender: a, Weight: 3},
+		smsenderu.RouterBackend{Name: "b", Sender: b, Weight: 1},
+	)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{
+			"79000000000", "79000000001", "79000000002", "79000000003",
+			"79000000004", "79000000005", "79000000006", "79000000007",
+		},
+		Message: "Code: 1234",
+	}
+
+	// Route() is a preview, it must not shift the round-robin.
+	route, err := q.Route(context.Background(), req)
+	require.True(t, err.IsNil())
+	again, err := q.Route(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, route, again)
+
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 8)
+	for i, id := range resp.IDs {
+		require.EqualValues(t, []string{"a", "b"}[route[i]], q.BackendOf(id))
+	}
+	require.Len(t, a.Sent(), 6)
+	require.Len(t, b.Sent(), 2)
+
+	for i, id := range resp.IDs {
+		require.Contains(t, []string{"a", "b"}, q.BackendOf(id))
+		require.EqualValues(t, id, resp.Results[i].ID)
+	}
+	require.Nil(t, resp.Balance, "Balances of different backends must not be merged")
+
+	status, err := q.Status(context.Background(), resp.IDs[3])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, resp.IDs[3], status.ID)
+	require.EqualValues(t, "79000000003", status.Recipient)
+}
+
+func TestRouter_Prefix(t *testing.T) {
+	ru, kz, other := smsenderu_mock.New(), smsenderu_mock.New(), smsenderu_mock.New()
+
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_PREFIX,
+		smsenderu.RouterBackend{Name: "ru", Sender: ru, Prefixes: []string{"79"}},
+		smsenderu.RouterBackend{Name: "kz", Sender: kz, Prefixes: []string{"+7 7"}},
+		smsenderu.RouterBackend{Name: "other", Sender: other, Weight: 1},
+	)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"+79000000000", "77000000000", "8 (900) 000-00-01"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "ru", q.BackendOf(resp.IDs[0]))
+	require.EqualValues(t, "kz", q.BackendOf(resp.IDs[1]), "Prefix must be normalized")
+	require.EqualValues(t, "ru", q.BackendOf(resp.IDs[2]), "Phone number must be normalized")
+	require.Empty(t, other.Sent())
+}
+
+func TestRouter_Cheapest(t *testing.T) {
+	expensive := smsenderu_mock.New().SetCostPerMessage(decimal.NewFromInt(5))
+	cheap := smsenderu_mock.New().
+		SetCostPerMessage(decimal.NewFromInt(2)).
+		SetBalance(decimal.NewFromInt(100), "RUB")
+
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_CHEAPEST,
+		smsenderu.RouterBackend{Name: "expensive", Sender: expensive},
+		smsenderu.RouterBackend{Name: "cheap", Sender: cheap},
+	)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+	}
+
+	cost, err := q.Cost(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.True(t, cost.Total.Equal(decimal.NewFromInt(4)))
+
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "cheap", q.BackendOf(resp.IDs[0]))
+	require.EqualValues(t, "cheap", q.BackendOf(resp.IDs[1]))
+	require.Empty(t, expensive.Sent())
+}
+
+func TestRouter_Balance(t *testing.T) {
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_WEIGHTED,
+		smsenderu.RouterBackend{Name: "a", Sender: smsenderu_mock.New().SetBalance(decimal.NewFromInt(10), "RUB")},
+		smsenderu.RouterBackend{Name: "b", Sender: smsenderu_mock.New().SetBalance(decimal.NewFromInt(15), "RUB")},
+	)
+
+	balance, currency, err := q.Balance(context.Background())
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "RUB", currency)
+	require.True(t, balance.Equal(decimal.NewFromInt(25)))
+}
+
+func TestRouter_BackendFailed(t *testing.T) {
+	ok := smsenderu_mock.New()
+	failed := smsenderu_mock.New().
+		FailNext(smsenderu_mock.METHOD_SEND, smsenderu.ProviderUnavailable, 1)
+
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_PREFIX,
+		smsenderu.RouterBackend{Name: "ok", Sender: ok, Prefixes: []string{"79"}},
+		smsenderu.RouterBackend{Name: "failed", Sender: failed, Prefixes: []string{"77"}},
+	)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "77000000000"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.Is(smsenderu.PartialFailure))
+	require.EqualValues(t, "ok", q.BackendOf(resp.IDs[0]))
+
+	require.Empty(t, resp.IDs[1])
+	require.EqualValues(t, smsenderu.ERROR_CODE_NOT_SENT, resp.ErrorCodes[1])
+	require.EqualValues(t, "77000000000", resp.Results[1].Phone)
+	require.True(t, resp.Results[1].Err.Is(smsenderu.ProviderUnavailable))
+}
+
+func TestRouter_BalanceSharedAccount(t *testing.T) {
+	shared := smsenderu_mock.New().SetBalance(decimal.NewFromInt(10), "RUB")
+
+	q := smsenderu.NewRouter(smsenderu.ROUTER_STRATEGY_WEIGHTED,
+		smsenderu.RouterBackend{Name: "a", Sender: shared, Account: "mock:shared"},
+		smsenderu.RouterBackend{Name: "b", Sender: shared, Account: "mock:shared"},
+		smsenderu.RouterBackend{Name: "c", Sender: smsenderu_mock.New().SetBalance(decimal.NewFromInt(15), "RUB")},
+	)
+
+	balance, _, err := q.Balance(context.Background())
+	require.True(t, err.IsNil())
+	require.True(t, balance.Equal(decimal.NewFromInt(25)))
+
+	balance, err = q.BalanceIn(context.Background(), "RUB")
+	require.True(t, err.IsNil())
+	require.True(t, balance.Equal(decimal.NewFromInt(25)))
+}
@@ -0,0 +1,169 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_segment calculates how the message will be encoded
+// and how many SMS (segments) it will be split into, following 3GPP TS 23.038.
+//
+// The message is encoded using GSM-7 if all its characters are in the GSM-7
+// default alphabet or its extension table (the latter take 2 septets),
+// and using UCS-2 otherwise. Single SMS holds 160 septets (GSM-7) or 70 UTF-16
+// code units (UCS-2). Multipart SMS lose some space for the concatenation header:
+// 153 septets or 67 code units per segment. Escaped GSM-7 characters and
+// surrogate pairs are never split between segments.
+package smsenderu_segment
+
+import (
+	"unicode/utf16"
+)
+
+type (
+	// Encoding is the encoding the message is sent using.
+	Encoding uint8
+
+	// Info is the result of Calculate().
+	Info struct {
+
+		// Encoding is the encoding of message: GSM-7 or UCS-2.
+		Encoding Encoding
+
+		// Segments is the number of SMS the message will be split into.
+		// It's 0 for the empty message.
+		Segments int
+
+		// Length is the length of message in the units of Encoding:
+		// GSM-7 septets (2 for extension characters) or UTF-16 code units.
+		Length int
+
+		// CharsLeft is the number of Encoding's units that could be added
+		// to the message without increasing the number of segments.
+		CharsLeft int
+
+		// UCS2Chars are the unique characters that are not in the GSM-7 alphabet
+		// and force the message to be encoded using UCS-2,
+		// in the order of the first appearance.
+		UCS2Chars []rune
+	}
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	ENCODING_GSM7 Encoding = 1 + iota
+	ENCODING_UCS2
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	GSM7_SINGLE_LIMIT    = 160
+	GSM7_MULTIPART_LIMIT = 153
+	UCS2_SINGLE_LIMIT    = 70
+	UCS2_MULTIPART_LIMIT = 67
+)
+
+var (
+	// gsm7Basic is the GSM-7 default alphabet (1 septet each).
+	gsm7Basic = makeCharset("@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà")
+
+	// gsm7Extension is the GSM-7 extension table (2 septets each: ESC + char).
+	gsm7Extension = makeCharset("\f^{}\\[~]|€")
+)
+
+// Calculate returns an info about how message will be encoded and split.
+// message must be UTF-8 encoded.
+func Calculate(message string) Info {
+
+	info := Info{Encoding: ENCODING_GSM7}
+	seen := make(map[rune]struct{})
+
+	for _, r := range message {
+		if _, ok := gsm7Basic[r]; ok {
+			continue
+		}
+		if _, ok := gsm7Extension[r]; ok {
+			continue
+		}
+		info.Encoding = ENCODING_UCS2
+		if _, ok := seen[r]; !ok {
+			seen[r] = struct{}{}
+			info.UCS2Chars = append(info.UCS2Chars, r)
+		}
+	}
+
+	single, multipart := GSM7_SINGLE_LIMIT, GSM7_MULTIPART_LIMIT
+	if info.Encoding == ENCODING_UCS2 {
+		single, multipart = UCS2_SINGLE_LIMIT, UCS2_MULTIPART_LIMIT
+	}
+
+	for _, r := range message {
+		info.Length += info.Encoding.unitsOf(r)
+	}
+
+	switch {
+
+	case info.Length == 0:
+		info.CharsLeft = single
+
+	case info.Length <= single:
+		info.Segments, info.CharsLeft = 1, single-info.Length
+
+	default:
+		// Characters are not split between segments, so segments
+		// might be filled partially. Count them one by one.
+		used := 0
+		info.Segments = 1
+		for _, r := range message {
+			units := info.Encoding.unitsOf(r)
+			if used+units > multipart {
+				info.Segments++
+				used = 0
+			}
+			used += units
+		}
+		info.CharsLeft = multipart - used
+	}
+
+	return info
+}
+
+// Segments returns the number of SMS the message will be split into.
+// It's a shorthand for Calculate(message).Segments.
+func Segments(message string) int {
+	return Calculate(message).Segments
+}
+
+// String returns the name of encoding: "GSM-7", "UCS-2" or an empty string.
+func (e Encoding) String() string {
+	switch e {
+	case ENCODING_GSM7:
+		return "GSM-7"
+	case ENCODING_UCS2:
+		return "UCS-2"
+	default:
+		return ""
+	}
+}
+
+// unitsOf returns the number of encoding's units r takes.
+func (e Encoding) unitsOf(r rune) int {
+	if e == ENCODING_UCS2 {
+		if utf16.IsSurrogate(r) || r > 0xFFFF {
+			return 2
+		}
+		return 1
+	}
+	if _, ok := gsm7Extension[r]; ok {
+		return 2
+	}
+	return 1
+}
+
+// makeCharset returns the set of chars.
+func makeCharset(chars string) map[rune]struct{} {
+	charset := make(map[rune]struct{}, len(chars))
+	for _, r := range chars {
+		charset[r] = struct{}{}
+	}
+	return charset
+}
@@ -0,0 +1,51 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_segment_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/smsenderu/segment"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		message   string
+		encoding  smsenderu_segment.Encoding
+		segments  int
+		length    int
+		charsLeft int
+	}{
+		{"", smsenderu_segment.ENCODING_GSM7, 0, 0, 160},
+		{"Code: 1234", smsenderu_segment.ENCODING_GSM7, 1, 10, 150},
+		{strings.Repeat("a", 160), smsenderu_segment.ENCODING_GSM7, 1, 160, 0},
+		{strings.Repeat("a", 161), smsenderu_segment.ENCODING_GSM7, 2, 161, 145},
+		{"Price: 10€", smsenderu_segment.ENCODING_GSM7, 1, 11, 149},
+		{strings.Repeat("a", 152) + "€" + strings.Repeat("a", 10), smsenderu_segment.ENCODING_GSM7, 2, 164, 141},
+		{"Код: 1234", smsenderu_segment.ENCODING_UCS2, 1, 9, 61},
+		{strings.Repeat("ы", 70), smsenderu_segment.ENCODING_UCS2, 1, 70, 0},
+		{strings.Repeat("ы", 71), smsenderu_segment.ENCODING_UCS2, 2, 71, 63},
+		{strings.Repeat("ы", 66) + "😀ыыы", smsenderu_segment.ENCODING_UCS2, 2, 71, 62},
+	}
+	for _, test := range tests {
+		info := smsenderu_segment.Calculate(test.message)
+		require.EqualValues(t, test.encoding, info.Encoding, test.message)
+		require.EqualValues(t, test.segments, info.Segments, test.message)
+		require.EqualValues(t, test.length, info.Length, test.message)
+		require.EqualValues(t, test.charsLeft, info.CharsLeft, test.message)
+	}
+}
+
+func TestCalculate_UCS2Chars(t *testing.T) {
+	info := smsenderu_segment.Calculate("Hello, мир! Привет")
+	require.EqualValues(t, []rune("мирПвет"), info.UCS2Chars)
+
+	info = smsenderu_segment.Calculate("Hello, world! {}")
+	require.Empty(t, info.UCS2Chars)
+}
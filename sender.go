@@ -6,30 +6,37 @@
 package smsenderu
 
 import (
+	"context"
+
 	"github.com/shopspring/decimal"
 
 	"github.com/qioalice/ekago/v3/ekaerr"
 )
 
 type (
+	// Sender is an interface of SMS API provider.
+	//
+	// Each method takes a context.Context that allows to set a deadline
+	// or cancel an in-flight API request. If it happens, the returned error
+	// will be of Canceled or DeadlineExceeded class (see ContextError()).
 	Sender interface {
 
 		// Check must checks whether Sender was initialized properly
 		// and it's very recommend to do a test API service request (kinda ping)
 		// or another way attempt to figure out whether provided service's credentials
 		// (login-password, login-token, something else) are valid.
-		Check() *ekaerr.Error
+		Check(ctx context.Context) *ekaerr.Error
 
-		Balance() (balance decimal.Decimal, currency string, err *ekaerr.Error)
-		BalanceIn(currency string) (balance decimal.Decimal, err *ekaerr.Error)
+		Balance(ctx context.Context) (balance decimal.Decimal, currency string, err *ekaerr.Error)
+		BalanceIn(ctx context.Context, currency string) (balance decimal.Decimal, err *ekaerr.Error)
 
 		// Senders must return a list of available senders,
 		// that can be used through API as a displayable sender for recipients.
-		Senders() ([]string, *ekaerr.Error)
+		Senders(ctx context.Context) ([]string, *ekaerr.Error)
 
-		Send(req *SendMessageRequest) (resp *SendMessageResponse, err *ekaerr.Error)
-		Cost(req *SendMessageRequest) (resp *CostSendMessageResponse, err *ekaerr.Error)
+		Send(ctx context.Context, req *SendMessageRequest) (resp *SendMessageResponse, err *ekaerr.Error)
+		Cost(ctx context.Context, req *SendMessageRequest) (resp *CostSendMessageResponse, err *ekaerr.Error)
 
-		Status(sentSmsId string) (resp *StatusMessageResponse, err *ekaerr.Error)
+		Status(ctx context.Context, sentSmsId string) (resp *StatusMessageResponse, err *ekaerr.Error)
 	}
 )
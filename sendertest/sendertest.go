@@ -0,0 +1,277 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_sendertest provides a conformance test suite
+// for smsenderu.Sender's implementations. It checks the contracts
+// that are documented at the smsenderu package.
+//
+// The suite does real calls of Sender's methods, so the Sender under the test
+// must be bound to the local stand-in server of its API provider.
+package smsenderu_sendertest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+	"github.com/qioalice/ekago/v3/ekatime"
+
+	"github.com/qioalice/smsenderu"
+)
+
+type (
+	// Config is the set of Sender's constructors and provider's specific
+	// values the suite is run with.
+	Config struct {
+
+		// NewSender must return a new valid Sender that is bound to
+		// the local stand-in server. It's called once per each test. Required.
+		NewSender func(t *testing.T) smsenderu.Sender
+
+		// NewSenderWithToken must return a new Sender that is bound to
+		// the same stand-in server but uses provided API token.
+		// Optional. Tests of empty token are skipped if it's nil.
+		NewSenderWithToken func(t *testing.T, token string) smsenderu.Sender
+
+		// NilSender must be a typed nil of Sender's implementation,
+		// like smsenderu.Sender((*yourSender)(nil)).
+		// Optional. Tests of nil receiver are skipped if it's nil.
+		NilSender smsenderu.Sender
+
+		// Recipients is a set of valid phone numbers messages might be sent to.
+		// At least 2 are required.
+		Recipients []string
+
+		// StatusOK is the provider's error code of successfully sent message.
+		StatusOK int
+	}
+)
+
+// Run runs the conformance test suite against the Sender's implementation
+// that is described by cfg.
+func Run(t *testing.T, cfg Config) {
+
+	require.NotNil(t, cfg.NewSender, "Config.NewSender is required")
+	require.True(t, len(cfg.Recipients) >= 2, "Config.Recipients must contain at least 2 phone numbers")
+
+	t.Run("Check", func(t *testing.T) { testCheck(t, cfg) })
+	t.Run("SendResponseLengths", func(t *testing.T) { testSendResponseLengths(t, cfg) })
+	t.Run("SendAtInPast", func(t *testing.T) { testSendAtInPast(t, cfg) })
+	t.Run("TTLRange", func(t *testing.T) { testTTLRange(t, cfg) })
+	t.Run("InvalidRequests", func(t *testing.T) { testInvalidRequests(t, cfg) })
+	t.Run("CostOrdering", func(t *testing.T) { testCostOrdering(t, cfg) })
+	t.Run("Status", func(t *testing.T) { testStatus(t, cfg) })
+	t.Run("Canceled", func(t *testing.T) { testCanceled(t, cfg) })
+	t.Run("NilReceiver", func(t *testing.T) { testNilReceiver(t, cfg) })
+	t.Run("EmptyToken", func(t *testing.T) { testEmptyToken(t, cfg) })
+}
+
+func testCheck(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+	require.True(t, q.Check(context.Background()).IsNil())
+}
+
+func testSendResponseLengths(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: cfg.Recipients[0],
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotNil(t, resp)
+	require.Len(t, resp.IDs, 1)
+	require.Len(t, resp.ErrorCodes, 1)
+
+	resp, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: cfg.Recipients,
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotNil(t, resp)
+	require.Len(t, resp.IDs, len(cfg.Recipients))
+	require.Len(t, resp.ErrorCodes, len(cfg.Recipients))
+
+	for i := range cfg.Recipients {
+		if resp.ErrorCodes[i] == cfg.StatusOK {
+			require.NotEmpty(t, resp.IDs[i], "ID of successfully sent message must not be empty")
+		} else {
+			require.Empty(t, resp.IDs[i], "ID of not sent message must be empty")
+		}
+	}
+
+	if resp.Results == nil {
+		return // per recipient results are not supported
+	}
+
+	require.Len(t, resp.Results, len(cfg.Recipients))
+	for i, result := range resp.Results {
+		require.EqualValues(t, resp.IDs[i], result.ID, "Results must match IDs")
+		require.EqualValues(t, resp.ErrorCodes[i], result.ErrorCode, "Results must match ErrorCodes")
+		require.NotEmpty(t, result.Phone)
+	}
+}
+
+func testSendAtInPast(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: cfg.Recipients[0],
+		Message:   "Code: 1234",
+		SendAt:    ekatime.NewTimestampNow() - ekatime.SECONDS_IN_HOUR,
+	})
+	require.True(t, err.IsNil(), "SendAt in the past must be ignored")
+	require.Len(t, resp.ErrorCodes, 1)
+	require.EqualValues(t, cfg.StatusOK, resp.ErrorCodes[0])
+}
+
+func testTTLRange(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	for _, ttl := range []time.Duration{30 * time.Second, 25 * time.Hour} {
+		_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+			Recipient: cfg.Recipients[0],
+			Message:   "Code: 1234",
+			TTL:       ttl,
+		})
+		require.True(t, err.IsNotNil(), "TTL out of [1m..24h] must be rejected, got %s", ttl)
+	}
+
+	for _, ttl := range []time.Duration{0, time.Minute, 24 * time.Hour} {
+		_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+			Recipient: cfg.Recipients[0],
+			Message:   "Code: 1234",
+			TTL:       ttl,
+		})
+		require.True(t, err.IsNil(), "TTL in [1m..24h] or 0 must be accepted, got %s", ttl)
+	}
+}
+
+func testInvalidRequests(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	invalid := map[string]*smsenderu.SendMessageRequest{
+		"Nil":          nil,
+		"NoRecipients": {Message: "Code: 1234"},
+		"NoMessage":    {Recipient: cfg.Recipients[0]},
+	}
+
+	for name, req := range invalid {
+		_, err := q.Send(context.Background(), req)
+		require.True(t, err.Is(ekaerr.IllegalArgument), "Send: %s request must be rejected", name)
+
+		_, err = q.Cost(context.Background(), req)
+		require.True(t, err.Is(ekaerr.IllegalArgument), "Cost: %s request must be rejected", name)
+	}
+
+	_, err := q.Status(context.Background(), "")
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Status: empty ID must be rejected")
+}
+
+func testCostOrdering(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	resp, err := q.Cost(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: cfg.Recipients,
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotNil(t, resp)
+	require.False(t, resp.Total.IsNegative())
+
+	if resp.Segments != nil {
+		require.Len(t, resp.Segments, len(cfg.Recipients))
+		totalSegments := 0
+		for _, segments := range resp.Segments {
+			totalSegments += segments
+		}
+		require.EqualValues(t, resp.TotalSegments, totalSegments, "TotalSegments must be a sum of Segments")
+	}
+
+	if resp.Costs == nil {
+		return // per recipient costs are not supported
+	}
+
+	require.Len(t, resp.Costs, len(cfg.Recipients))
+	total := decimal.Zero
+	for _, cost := range resp.Costs {
+		total = total.Add(cost)
+	}
+	require.True(t, total.Equal(resp.Total), "Total must be a sum of Costs")
+}
+
+func testStatus(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	sendResp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: cfg.Recipients[0],
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotEmpty(t, sendResp.IDs[0])
+
+	resp, err := q.Status(context.Background(), sendResp.IDs[0])
+	require.True(t, err.IsNil())
+	require.NotNil(t, resp)
+	require.EqualValues(t, sendResp.IDs[0], resp.ID)
+}
+
+func testCanceled(t *testing.T, cfg Config) {
+	q := cfg.NewSender(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.True(t, q.Check(ctx).Is(smsenderu.Canceled))
+
+	_, _, err := q.Balance(ctx)
+	require.True(t, err.Is(smsenderu.Canceled))
+}
+
+func testNilReceiver(t *testing.T, cfg Config) {
+	if cfg.NilSender == nil {
+		t.Skip("Config.NilSender is not provided")
+	}
+	testAllMethodsFail(t, cfg.NilSender, cfg)
+}
+
+func testEmptyToken(t *testing.T, cfg Config) {
+	if cfg.NewSenderWithToken == nil {
+		t.Skip("Config.NewSenderWithToken is not provided")
+	}
+	testAllMethodsFail(t, cfg.NewSenderWithToken(t, ""), cfg)
+}
+
+// testAllMethodsFail checks that each Sender's method returns an error
+// of IllegalArgument class not even trying to perform a request.
+func testAllMethodsFail(t *testing.T, q smsenderu.Sender, cfg Config) {
+
+	ctx := context.Background()
+	req := &smsenderu.SendMessageRequest{
+		Recipient: cfg.Recipients[0],
+		Message:   "Code: 1234",
+	}
+
+	require.True(t, q.Check(ctx).Is(ekaerr.IllegalArgument), "Check")
+
+	_, _, err := q.Balance(ctx)
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Balance")
+
+	_, err = q.Senders(ctx)
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Senders")
+
+	_, err = q.Send(ctx, req)
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Send")
+
+	_, err = q.Cost(ctx, req)
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Cost")
+
+	_, err = q.Status(ctx, "1")
+	require.True(t, err.Is(ekaerr.IllegalArgument), "Status")
+}
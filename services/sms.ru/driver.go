@@ -0,0 +1,94 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+)
+
+// DRIVER_NAME is the name sms.ru Sender's driver is registered with.
+// Use it as a scheme of the connection string:
+//     smsru://TOKEN?timeout=5s&from=MyShop
+//
+// Supported driver specific parameters are:
+// "read_timeout", "write_timeout" (durations), "max_conns", "max_redirects" (ints),
+// "retry_max_attempts" (int, enables DefaultRetryPolicy with that many attempts),
+// "text_format" (bool, see WithTextFormat()).
+//goland:noinspection GoSnakeCaseUsage
+const DRIVER_NAME = "smsru"
+
+func init() {
+	smsenderu.Register(DRIVER_NAME, smsenderu.DriverFunc(openDriver))
+}
+
+func openDriver(cfg *smsenderu.Config) (smsenderu.Sender, *ekaerr.Error) {
+	const s = "SMS.RU: Failed to open Sender using config."
+
+	options := []Option{
+		WithTimeout(cfg.Timeout),
+		WithDefaultFrom(cfg.From),
+		WithBaseURL(cfg.BaseURL),
+	}
+
+	for key, value := range cfg.Params {
+		var (
+			duration  time.Duration
+			n         int
+			legacyErr error
+		)
+
+		switch key {
+
+		case "read_timeout":
+			duration, legacyErr = time.ParseDuration(value)
+			options = append(options, WithReadTimeout(duration))
+
+		case "write_timeout":
+			duration, legacyErr = time.ParseDuration(value)
+			options = append(options, WithWriteTimeout(duration))
+
+		case "max_conns":
+			n, legacyErr = strconv.Atoi(value)
+			options = append(options, WithMaxConns(n))
+
+		case "max_redirects":
+			n, legacyErr = strconv.Atoi(value)
+			options = append(options, WithMaxRedirects(n))
+
+		case "text_format":
+			var textFormat bool
+			if textFormat, legacyErr = strconv.ParseBool(value); textFormat {
+				options = append(options, WithTextFormat())
+			}
+
+		case "retry_max_attempts":
+			policy := DefaultRetryPolicy
+			policy.MaxAttempts, legacyErr = strconv.Atoi(value)
+			options = append(options, WithRetry(policy))
+
+		default:
+			return nil, ekaerr.IllegalArgument.New(s).
+				WithString("description", "Unsupported parameter.").
+				WithString("smsru_param", key).
+				Throw()
+		}
+
+		if legacyErr != nil {
+			return nil, ekaerr.IllegalFormat.Wrap(legacyErr, s).
+				WithString("description", "Incorrect parameter's value.").
+				WithString("smsru_param", key).
+				WithString("smsru_param_value", value).
+				Throw()
+		}
+	}
+
+	return NewSender(cfg.Token, options...), nil
+}
@@ -0,0 +1,13 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"github.com/qioalice/smsenderu"
+)
+
+// NilSender is a typed nil of sms.ru Sender, used by the conformance tests.
+var NilSender smsenderu.Sender = (*senderSmsRu)(nil)
@@ -0,0 +1,170 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/numplan"
+)
+
+type (
+	// Option is a NewSender()'s option that allows to change
+	// the default behaviour of sms.ru Sender.
+	Option func(cfg *senderSmsRuConfig)
+)
+
+const (
+	// DefaultBaseURL is the sms.ru API's base URL that is used
+	// if WithBaseURL() option is not presented.
+	DefaultBaseURL = "https://sms.ru"
+
+	// DefaultMaxRedirects is the max number of HTTP redirects that will be followed
+	// if WithMaxRedirects() option is not presented.
+	DefaultMaxRedirects = 5
+
+	// DefaultRecipientsCacheSize is the number of the last sent messages
+	// which recipients are remembered to be reported by Status(),
+	// if WithRecipientsCacheSize() option is not presented.
+	DefaultRecipientsCacheSize = 10000
+)
+
+// WithBaseURL overrides the sms.ru API's base URL (DefaultBaseURL).
+// It's useful if you want to use a local stand-in server or a proxy.
+// The empty string is ignored.
+func WithBaseURL(baseURL string) Option {
+	return func(cfg *senderSmsRuConfig) {
+		if baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/"); baseURL != "" {
+			cfg.baseURL = baseURL
+		}
+	}
+}
+
+// WithDefaultFrom sets the sender that is used
+// if SendMessageRequest.From is not presented.
+func WithDefaultFrom(from string) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.from = strings.TrimSpace(from)
+	}
+}
+
+// WithTransport makes sms.ru Sender to use provided smsenderu.Transport
+// for the outgoing API requests. It's the way to use net/http
+// (see smsenderu.NewNetHTTPTransport()) or to share a connection pool
+// between many Senders.
+//
+// If provided, all HTTP client related options (WithClient(), WithDialer(),
+// WithReadTimeout(), WithWriteTimeout(), WithMaxConns(), WithMaxRedirects())
+// are ignored. Nil is ignored.
+func WithTransport(transport smsenderu.Transport) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.transport = transport
+	}
+}
+
+// WithClient makes sms.ru Sender to use provided preconfigured fasthttp.Client.
+//
+// If provided, the options of the HTTP client itself (WithDialer(),
+// WithReadTimeout(), WithWriteTimeout(), WithMaxConns()) are ignored
+// and client is used as is. Nil is ignored.
+func WithClient(client *fasthttp.Client) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.client = client
+	}
+}
+
+// WithDialer sets the dial function that will be used by fasthttp.Client
+// to establish new connections.
+func WithDialer(dial fasthttp.DialFunc) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.dial = dial
+	}
+}
+
+// WithReadTimeout sets the max duration for the full response reading
+// (including body). Non-positive value means no timeout.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout sets the max duration for the full request writing
+// (including body). Non-positive value means no timeout.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.writeTimeout = timeout
+	}
+}
+
+// WithTimeout sets the max duration of the whole Sender's method call,
+// including redirects and retries (see WithRetry()). It's applied in addition to the deadline
+// of the context.Context, that is passed to the method (the earliest one wins).
+// Non-positive value means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.timeout = timeout
+	}
+}
+
+// WithMaxConns sets the max number of connections to the sms.ru API host.
+// fasthttp.DefaultMaxConnsPerHost is used if it's not positive.
+func WithMaxConns(maxConns int) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.maxConns = maxConns
+	}
+}
+
+// WithMaxRedirects sets the max number of HTTP redirects that will be followed.
+// Zero means redirects are not followed. Negative value is ignored.
+func WithMaxRedirects(maxRedirects int) Option {
+	return func(cfg *senderSmsRuConfig) {
+		if maxRedirects >= 0 {
+			cfg.maxRedirects = maxRedirects
+		}
+	}
+}
+
+// WithRetry enables retrying of failed API requests according to policy.
+// See RetryPolicy for the details which failures are retried.
+func WithRetry(policy RetryPolicy) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.retry = policy
+	}
+}
+
+// WithNumberingPlan sets the numbering plan that is used by Status()
+// to fill the country, the region and the operator of message's recipient.
+// smsenderu_numplan.Default() is used if this option is not presented.
+// Nil disables it.
+func WithNumberingPlan(plan *smsenderu_numplan.Plan) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.numplan, cfg.noNumplan = plan, plan == nil
+	}
+}
+
+// WithRecipientsCacheSize sets the number of the last sent messages
+// which recipients are remembered to be reported by Status()
+// (sms.ru API doesn't report it). Non-positive value disables it.
+func WithRecipientsCacheSize(size int) Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.cacheSize = size
+	}
+}
+
+// WithTextFormat makes Sender to request sms.ru API responses in the legacy
+// text format (one value per line) instead of JSON. The text format has less data:
+// no cost per recipient and no status texts (they are filled locally).
+// Responses are decoded according to their actual format anyway.
+func WithTextFormat() Option {
+	return func(cfg *senderSmsRuConfig) {
+		cfg.textFormat = true
+	}
+}
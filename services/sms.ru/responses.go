@@ -0,0 +1,268 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+type (
+	// response is a decoded sms.ru API response of some method.
+	// It's decoded from JSON (json=1) or, as a fallback, from the legacy
+	// text format, one value per line.
+	response interface {
+
+		// status returns the status of the whole response.
+		status() *responseStatus
+
+		// decodeText fills the response using the lines of text format response
+		// (without the status line) and the arguments of request.
+		// Returns false if lines are malformed.
+		decodeText(lines [][]byte, args url.Values) bool
+	}
+
+	// responseStatus is the status of sms.ru API response,
+	// or the status of one message in it.
+	responseStatus struct {
+		Status     string `json:"status"`
+		StatusCode int    `json:"status_code"`
+		StatusText string `json:"status_text"`
+	}
+
+	// checkResponse is the response of https://sms.ru/api/auth_check.
+	checkResponse struct {
+		responseStatus
+	}
+
+	// balanceResponse is the response of https://sms.ru/api/balance.
+	balanceResponse struct {
+		responseStatus
+		Balance decimal.Decimal `json:"balance"`
+	}
+
+	// sendersResponse is the response of https://sms.ru/api/senders.
+	sendersResponse struct {
+		responseStatus
+		Senders []string `json:"senders"`
+	}
+
+	// sendResponse is the response of https://sms.ru/api/send.
+	// SMS are the results by the recipients' phone numbers.
+	// Balance is nil if it's not reported.
+	sendResponse struct {
+		responseStatus
+		SMS     map[string]*smsResult `json:"sms"`
+		Balance *decimal.Decimal      `json:"balance"`
+	}
+
+	// costResponse is the response of https://sms.ru/api/cost.
+	// SMS are the costs by the recipients' phone numbers.
+	costResponse struct {
+		responseStatus
+		SMS       map[string]*smsResult `json:"sms"`
+		TotalCost decimal.Decimal       `json:"total_cost"`
+		TotalSMS  int                   `json:"total_sms"`
+	}
+
+	// statusResponse is the response of https://sms.ru/api/status.
+	// SMS are the statuses by the messages' IDs.
+	statusResponse struct {
+		responseStatus
+		SMS map[string]*smsResult `json:"sms"`
+	}
+
+	// smsResult is the result of sending, cost or status of one message.
+	// StatusCode is the message's own code (error, or delivery status).
+	smsResult struct {
+		responseStatus
+		SmsID string          `json:"sms_id"`
+		Cost  decimal.Decimal `json:"cost"`
+		SMS   int             `json:"sms"`
+	}
+)
+
+func (q *responseStatus) status() *responseStatus {
+	return q
+}
+
+func (q *checkResponse) decodeText(_ [][]byte, _ url.Values) bool {
+	return true
+}
+
+func (q *balanceResponse) decodeText(lines [][]byte, _ url.Values) bool {
+	if len(lines) < 1 {
+		return false
+	}
+	var err error
+	q.Balance, err = decimal.NewFromString(string(lines[0]))
+	return err == nil
+}
+
+func (q *sendersResponse) decodeText(lines [][]byte, _ url.Values) bool {
+	for _, line := range lines {
+		if len(line) > 0 {
+			q.Senders = append(q.Senders, string(line))
+		}
+	}
+	return true
+}
+
+func (q *sendResponse) decodeText(lines [][]byte, args url.Values) bool {
+
+	// A line per recipient (an ID or an error code)
+	// +1 more line (the current balance after sending).
+	recipients := recipientsOfArgs(args)
+	if len(lines) < len(recipients) {
+		return false
+	}
+
+	q.SMS = make(map[string]*smsResult, len(recipients))
+	for i, recipient := range recipients {
+		result := new(smsResult)
+		if len(lines[i]) <= 3 {
+			// Seems like error code
+			result.StatusCode, _ = strconv.Atoi(string(lines[i]))
+			result.StatusText = StatusText(result.StatusCode)
+		} else {
+			result.StatusCode, result.SmsID = STATUS_OK, string(lines[i])
+		}
+		q.SMS[recipient] = result
+	}
+
+	if len(lines) > len(recipients) {
+		balance := bytes.TrimPrefix(lines[len(recipients)], []byte("balance="))
+		if v, err := decimal.NewFromString(string(balance)); err == nil {
+			q.Balance = &v
+		}
+	}
+
+	return true
+}
+
+func (q *costResponse) decodeText(lines [][]byte, _ url.Values) bool {
+
+	// The total cost and the total number of sms.
+	// There is no cost per recipient in the text format.
+	if len(lines) < 2 {
+		return false
+	}
+
+	var err error
+	if q.TotalCost, err = decimal.NewFromString(string(lines[0])); err != nil {
+		return false
+	}
+
+	q.TotalSMS, err = strconv.Atoi(string(lines[1]))
+	return err == nil
+}
+
+func (q *statusResponse) decodeText(lines [][]byte, args url.Values) bool {
+
+	// A status code per message's ID.
+	ids := strings.Split(args.Get("sms_id"), ",")
+	if len(lines) < len(ids) {
+		return false
+	}
+
+	q.SMS = make(map[string]*smsResult, len(ids))
+	for i, id := range ids {
+		result := new(smsResult)
+		result.StatusCode, _ = strconv.Atoi(string(lines[i]))
+		result.StatusText = StatusText(result.StatusCode)
+		q.SMS[id] = result
+	}
+
+	return true
+}
+
+// decodeResponse decodes sms.ru API response body to resp
+// and returns its status code, or 0 if body is malformed.
+// The format (JSON or text) is detected by the body itself.
+func decodeResponse(body []byte, args url.Values, resp response) (statusCode int) {
+
+	*resp.status() = responseStatus{}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, resp); err != nil {
+			return 0
+		}
+		return resp.status().StatusCode
+	}
+
+	statusCode, lines := decodeTextResponse(body)
+	resp.status().StatusCode = statusCode
+	resp.status().StatusText = StatusText(statusCode)
+
+	if statusCode == STATUS_OK && !resp.decodeText(lines, args) {
+		return 0
+	}
+
+	return statusCode
+}
+
+// decodeTextResponse splits the legacy text format response to the status code
+// (the first line) and the other lines.
+func decodeTextResponse(b []byte) (statusCode int, lines [][]byte) {
+
+	n := len(b)
+	if n == 0 {
+		return 0, nil
+	}
+
+	lines = make([][]byte, 0, 16)
+
+	for i := 0; i < n; i++ {
+		j := i
+		for ; i < n && b[i] != '\n'; i++ {
+		}
+		lines = append(lines, b[j:i])
+	}
+
+	statusCodeLine := lines[0]
+	lines = lines[1:]
+
+	statusCode, _ = strconv.Atoi(string(statusCodeLine))
+
+	return statusCode, lines
+}
+
+// recipientsOfArgs returns the recipients of sending (or cost) request
+// in the order sms.ru responds about them: the order of "to" argument,
+// or the order of "multi[phone]" arguments, which are sorted by their keys.
+func recipientsOfArgs(args url.Values) []string {
+
+	if to := args.Get("to"); to != "" {
+		return strings.Split(to, ",")
+	}
+
+	var keys []string
+	for key := range args {
+		if strings.HasPrefix(key, "multi[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	recipients := make([]string, len(keys))
+	for i, key := range keys {
+		recipients[i] = strings.TrimSuffix(strings.TrimPrefix(key, "multi["), "]")
+	}
+
+	return recipients
+}
+
+// StatusText returns the human readable meaning of sms.ru status
+// or error code, or an empty string if the code is unknown.
+func StatusText(code int) string {
+	return statusCodeMeaningMap[code]
+}
@@ -0,0 +1,143 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+type (
+	// RetryPolicy describes how sms.ru Sender retries failed API requests.
+	// Use WithRetry() option to enable it.
+	//
+	// Only the failures that are safe to retry are retried:
+	//   - sms.ru "temporary unavailable" (220) status code,
+	//   - HTTP 429 Too Many Requests, HTTP 503 Service Unavailable,
+	//     which mean the request has not been processed;
+	//   - transport errors, attempt timeouts, other HTTP 5xx codes
+	//     and sms.ru "internal server error" (500) status code.
+	//
+	// The last group is ambiguous: the request might have been processed
+	// by sms.ru anyway. It's fine for Check(), Balance(), Senders(), Cost(), Status(),
+	// but retrying Send() after such failure may lead to the message
+	// being sent twice. So Send() is not retried after ambiguous failure
+	// unless RetryAmbiguousSend is set.
+	//
+	// The number of attempts and their causes are attached to the returned error
+	// as "smsru_retry_attempts" and "smsru_retry_causes" fields.
+	RetryPolicy struct {
+
+		// MaxAttempts is the max number of attempts including the first one.
+		// Retrying is disabled if it's less than 2.
+		MaxAttempts int
+
+		// InitialBackoff is the delay before the second attempt.
+		InitialBackoff time.Duration
+
+		// MaxBackoff is the upper limit of the delay between attempts.
+		// Not limited if it's not positive.
+		MaxBackoff time.Duration
+
+		// Multiplier is the factor the delay is multiplied by after each attempt.
+		// Treated as 2 if it's less than 1.
+		Multiplier float64
+
+		// Jitter is the fraction [0..1] of the delay that is randomized
+		// to avoid the synchronized retries of many clients.
+		// The delay is chosen from [delay * (1 - Jitter), delay].
+		Jitter float64
+
+		// AttemptTimeout is the max duration of each attempt.
+		// The timeout of the whole call (WithTimeout()) is still applied.
+		// Not limited if it's not positive.
+		AttemptTimeout time.Duration
+
+		// RetryAmbiguousSend allows to retry Send() after ambiguous failures.
+		// Enable it only if double sending of the message is acceptable.
+		RetryAmbiguousSend bool
+	}
+
+	// retryKind is the kind of failure of API request in terms of retrying.
+	retryKind uint8
+)
+
+const (
+	retryNever     retryKind = iota // must not be retried
+	retrySafe                       // request has not been processed, safe to retry
+	retryAmbiguous                  // request might have been processed
+)
+
+// DefaultRetryPolicy is the RetryPolicy that is used
+// by the "retry_max_attempts" driver parameter.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// canRetry reports whether the failure of kind could be retried.
+// idempotent must be false for the requests that are not safe to repeat.
+func (q *RetryPolicy) canRetry(kind retryKind, idempotent bool) bool {
+	switch kind {
+	case retrySafe:
+		return true
+	case retryAmbiguous:
+		return idempotent || q.RetryAmbiguousSend
+	default:
+		return false
+	}
+}
+
+// backoff returns the delay after the attempt-th failed attempt (starting from 1).
+func (q *RetryPolicy) backoff(attempt int) time.Duration {
+
+	multiplier := q.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(q.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if q.MaxBackoff > 0 && delay >= float64(q.MaxBackoff) {
+			break
+		}
+	}
+
+	if q.MaxBackoff > 0 && delay > float64(q.MaxBackoff) {
+		delay = float64(q.MaxBackoff)
+	}
+
+	if jitter := q.Jitter; jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= delay * jitter * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// sleep waits for d or until ctx is done. Returns false in the last case.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
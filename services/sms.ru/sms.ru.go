@@ -6,24 +6,28 @@
 package smsenderu_smsru
 
 import (
+	"context"
 	"strconv"
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/shopspring/decimal"
-	"github.com/valyala/fasthttp"
 
 	"github.com/qioalice/ekago/v3/ekaerr"
 	"github.com/qioalice/ekago/v3/ekastr"
 
 	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/segment"
+	"github.com/qioalice/smsenderu/translit"
 )
 
-func NewSender(token string) smsenderu.Sender {
-	return &senderSmsRu{token: token}
+// NewSender creates a new sms.ru Sender using provided API token.
+// Use options to override the API base URL, HTTP client and its limits.
+func NewSender(token string, options ...Option) smsenderu.Sender {
+	return newSenderSmsRu(token, options)
 }
 
-func (q *senderSmsRu) Check() *ekaerr.Error {
+func (q *senderSmsRu) Check(ctx context.Context) *ekaerr.Error {
 	// https://sms.ru/api/auth_check
 	const s = "SMS.RU: Failed to check whether provided API token is valid."
 	switch {
@@ -39,16 +43,10 @@ func (q *senderSmsRu) Check() *ekaerr.Error {
 			Throw()
 	}
 
-	const URL = "https://sms.ru/auth/check"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
+	const path = "/auth/check"
+	args := q.args()
 
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
-
-	_, err := q.do(fhReq, fhResp, 0)
+	_, err := q.do(ctx, path, args, true, new(checkResponse))
 	if err.IsNotNil() {
 		return err.
 			AddMessage(s).
@@ -58,7 +56,7 @@ func (q *senderSmsRu) Check() *ekaerr.Error {
 	return nil
 }
 
-func (q *senderSmsRu) Balance() (decimal.Decimal, string, *ekaerr.Error) {
+func (q *senderSmsRu) Balance(ctx context.Context) (decimal.Decimal, string, *ekaerr.Error) {
 	// https://sms.ru/api/balance
 	const s = "SMS.RU: Failed to get balance."
 	switch {
@@ -74,34 +72,20 @@ func (q *senderSmsRu) Balance() (decimal.Decimal, string, *ekaerr.Error) {
 			Throw()
 	}
 
-	const URL = "https://sms.ru/my/balance"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
-
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
+	const path = "/my/balance"
+	args := q.args()
 
-	respParts, err := q.do(fhReq, fhResp, 1)
-	if err.IsNotNil() {
+	resp := new(balanceResponse)
+	if _, err := q.do(ctx, path, args, true, resp); err.IsNotNil() {
 		return decimal.Zero, "", err.
 			AddMessage(s).
 			Throw()
 	}
 
-	balance, legacyErr := decimal.NewFromString(string(respParts[0]))
-	if legacyErr != nil {
-		return decimal.Zero, "", ekaerr.IllegalFormat.Wrap(legacyErr, s).
-			WithString("description", "Cannot decode balance value from API response.").
-			WithString("smsru_balance_raw", ekastr.B2S(respParts[0])).
-			Throw()
-	}
-
-	return balance, "RUB", nil
+	return resp.Balance, "RUB", nil
 }
 
-func (q *senderSmsRu) BalanceIn(currency string) (balance decimal.Decimal, err *ekaerr.Error) {
+func (q *senderSmsRu) BalanceIn(ctx context.Context, currency string) (balance decimal.Decimal, err *ekaerr.Error) {
 	const s = "SMS.RU: Failed to get balance in the specified currency."
 
 	currency = strings.TrimSpace(currency)
@@ -110,7 +94,7 @@ func (q *senderSmsRu) BalanceIn(currency string) (balance decimal.Decimal, err *
 	switch currency {
 
 	case "RUB":
-		balance, _, err = q.Balance()
+		balance, _, err = q.Balance(ctx)
 		return balance, err.
 			AddMessage(s).
 			Throw()
@@ -128,7 +112,7 @@ func (q *senderSmsRu) BalanceIn(currency string) (balance decimal.Decimal, err *
 	}
 }
 
-func (q *senderSmsRu) Senders() ([]string, *ekaerr.Error) {
+func (q *senderSmsRu) Senders(ctx context.Context) ([]string, *ekaerr.Error) {
 	// https://sms.ru/api/senders
 	const s = "SMS.RU: Failed to get registered senders."
 	switch {
@@ -144,36 +128,26 @@ func (q *senderSmsRu) Senders() ([]string, *ekaerr.Error) {
 			Throw()
 	}
 
-	const URL = "https://sms.ru/my/senders"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
-
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
+	const path = "/my/senders"
+	args := q.args()
 
-	respParts, err := q.do(fhReq, fhResp, 0)
-	if err.IsNotNil() {
+	resp := new(sendersResponse)
+	if _, err := q.do(ctx, path, args, true, resp); err.IsNotNil() {
 		return nil, err.
 			AddMessage(s).
 			Throw()
 	}
 
-	if len(respParts) == 0 {
+	if len(resp.Senders) == 0 {
 		return nil, nil
 	}
 
-	senders := make([]string, len(respParts))
-	for i, n := 0, len(respParts); i < n; i++ {
-		senders[i] = string(respParts[i])
-	}
-
-	return senders, nil
+	return resp.Senders, nil
 }
 
 func (q *senderSmsRu) Send(
 
+	ctx context.Context,
 	req *smsenderu.SendMessageRequest,
 ) (
 	resp *smsenderu.SendMessageResponse,
@@ -181,6 +155,8 @@ func (q *senderSmsRu) Send(
 ) {
 	// https://sms.ru/api/send
 	const s = "SMS.RU: Failed to send a message(s)."
+
+	whyInvalid := Validate(req)
 	switch {
 
 	case q == nil:
@@ -193,96 +169,201 @@ func (q *senderSmsRu) Send(
 			WithString("description", "API token is not provided or empty.").
 			Throw()
 
-	case !sendMessageRequestIsValid(req):
+	case req != nil && (req.IsPing || req.IsHLR):
+		return nil, ekaerr.UnsupportedOperation.New(s).
+			WithString("description", "HLR lookup and ping-SMS are not supported by sms.ru Sender.").
+			WithBool("smsru_is_ping", req.IsPing).
+			WithBool("smsru_is_hlr", req.IsHLR).
+			Throw()
+
+	case len(whyInvalid) > 0:
 		return nil, ekaerr.IllegalArgument.New(s).
 			WithString("description", "Incorrect argument(s) of sending message request.").
-			WithString("smsru_send_request_why_invalid", sendMessageRequestWhyInvalid(req)).
+			WithString("smsru_send_request_why_invalid", whyInvalid.String()).
 			WithString("smsru_send_request_dump", spew.Sdump(req)).
 			Throw()
 	}
 
-	const URL = "https://sms.ru/sms/send"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
+	req = normalizedRequest(req)
 
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
+	messages := req.AllMessages()
+	for i, message := range messages {
 
-	if req.Recipient != "" {
-		req.Recipients = []string{req.Recipient}
+		if i > 0 && message == messages[i-1] {
+			continue
+		}
+
+		// sms.ru transliterates message by itself. Its result is not known here,
+		// so the local ICAO transliteration is used as the close estimation.
+		if req.DoTransliterate {
+			message = smsenderu_translit.Transliterate(message, smsenderu_translit.STANDARD_ICAO)
+		}
+
+		if segments := smsenderu_segment.Calculate(message); segments.Segments > MAX_MESSAGE_SEGMENTS {
+			return nil, ekaerr.IllegalArgument.New(s).
+				WithString("description", "Message is too long.").
+				WithInt("smsru_message_index", i).
+				WithInt("smsru_message_segments", segments.Segments).
+				WithInt("smsru_message_max_segments", MAX_MESSAGE_SEGMENTS).
+				WithString("smsru_message_encoding", segments.Encoding.String()).
+				Throw()
+		}
 	}
 
-	fhReq.URI().QueryArgs().Add("to", strings.Join(req.Recipients, ","))
-	fhReq.URI().QueryArgs().Add("msg", req.Message)
+	// Invalid phone numbers are reported per recipient
+	// and are not sent to sms.ru at all.
+	recipients, invalid := parseRecipients(req)
+	if len(invalid) == len(recipients) {
+		return nil, invalidRecipientsError(s, recipients, invalid).
+			Throw()
+	}
 
-	if req.From != "" {
-		fhReq.URI().QueryArgs().Add("from", req.From)
+	// sent is the indexes of recipients the message is sent to.
+	sent := make([]int, 0, len(recipients)-len(invalid))
+	for i := range recipients {
+		if _, isInvalid := invalid[i]; !isInvalid {
+			sent = append(sent, i)
+		}
+	}
+
+	validRecipients := make([]string, len(sent))
+	for j, i := range sent {
+		validRecipients[j] = recipients[i]
+	}
+
+	if len(sent) > MAX_RECIPIENTS {
+		if resp, err = q.sendSplit(ctx, req, recipients, invalid, MAX_RECIPIENTS); err.IsNotNil() {
+			return resp, err.
+				AddMessage(s).
+				Throw()
+		}
+		return resp, nil
+	}
+
+	// sms.ru reports the results by phone numbers (as well as it gets
+	// personalized messages), so the same phone number can't be sent
+	// two messages at once.
+	if hasDuplicates(validRecipients) {
+		if resp, err = q.sendSplit(ctx, req, recipients, invalid, 1); err.IsNotNil() {
+			return resp, err.
+				AddMessage(s).
+				Throw()
+		}
+		return resp, nil
+	}
+
+	const path = "/sms/send"
+	args := q.args()
+
+	if len(req.Messages) == 0 {
+		args.Set("to", strings.Join(validRecipients, ","))
+		args.Set("msg", req.Message)
+	} else {
+		for _, i := range sent {
+			args.Set(multiKey(recipients[i]), messages[i])
+		}
+	}
+
+	if from := q.fromOf(req); from != "" {
+		args.Set("from", from)
 	}
 
 	if req.UserIP != "" {
-		fhReq.URI().QueryArgs().Add("ip", req.UserIP)
+		args.Set("ip", req.UserIP)
 	}
 
 	if req.SendAt != 0 {
 		v := strconv.FormatInt(req.SendAt.I64(), 10)
-		fhReq.URI().QueryArgs().Add("time", v)
+		args.Set("time", v)
 	}
 
 	if req.TTL != 0 {
 		v := strconv.Itoa(int(req.TTL.Minutes()))
-		fhReq.URI().QueryArgs().Add("ttl", v)
+		args.Set("ttl", v)
 	}
 
 	if req.EnableUserLocation {
-		fhReq.URI().QueryArgs().Add("daytime", "1")
+		args.Set("daytime", "1")
 	}
 
 	if req.DoTransliterate {
-		fhReq.URI().QueryArgs().Add("translit", "1")
+		args.Set("translit", "1")
 	}
 
-	// Response contain an info about each phone number's sending message
-	// +1 more row (the current balance after sending).
+	var (
+		sendResp = new(sendResponse)
+		respBody []byte
+	)
 
-	var respParts [][]byte
-	respParts, err = q.do(fhReq, fhResp, len(req.Recipients)+1)
-	if err.IsNotNil() {
+	if respBody, err = q.do(ctx, path, args, false, sendResp); err.IsNotNil() {
 		return nil, err.
 			AddMessage(s).
 			Throw()
 	}
 
-	if len(respParts) != len(req.Recipients)+1 {
-		return nil, ekaerr.IllegalFormat.New(s).
-			WithString("description", "Mismatch sizes of the response and request phone numbers.").
-			WithInt("smsru_send_request_phone_numbers", len(req.Recipients)).
-			WithInt("smsru_send_response_phone_numbers", len(respParts)).
-			WithString("smsru_send_request_dump", spew.Sdump(req)).
-			WithString("smsru_send_response_raw", ekastr.B2S(fhResp.Body())).
-			Throw()
-	}
-
 	resp = &smsenderu.SendMessageResponse{
-		IDs:        make([]string, len(req.Recipients)),
-		ErrorCodes: make([]int, len(req.Recipients)),
-	}
+		IDs:        make([]string, len(recipients)),
+		ErrorCodes: make([]int, len(recipients)),
+		Results:    make([]smsenderu.SendMessageResult, len(recipients)),
+		Balance:    sendResp.Balance,
+	}
+
+	markInvalidRecipients(resp, recipients, invalid)
+
+	// The message may have been sent to the recipients sms.ru hasn't reported
+	// about, so they are not sent again, but the IDs of the others are kept.
+	var missingErr *ekaerr.Error
+	nMissing := 0
+
+	for _, i := range sent {
+		result := sendResp.SMS[recipients[i]]
+		switch {
+
+		case result == nil:
+			missingErr = ekaerr.IllegalState.New(s).
+				WithString("description", "There is no result of sending message to the phone number in the response.").
+				WithInt("smsru_recipient_index", i).
+				WithString("smsru_send_response_raw", ekastr.B2S(respBody)).
+				Throw()
+			nMissing++
+
+			resp.ErrorCodes[i] = smsenderu.ERROR_CODE_NOT_SENT
+			resp.Results[i] = smsenderu.SendMessageResult{
+				Phone:      recipients[i],
+				ErrorCode:  smsenderu.ERROR_CODE_NOT_SENT,
+				StatusText: "There is no result of sending message in the response.",
+				Err:        missingErr,
+			}
+			continue
+
+		case result.StatusCode == STATUS_OK && result.SmsID != "":
+			resp.IDs[i] = result.SmsID
+			resp.ErrorCodes[i] = STATUS_OK
+			q.sent.add(resp.IDs[i], recipients[i])
 
-	// It's unnecessary but would even caller use SendMessageRequest object
-	// after that call?
-	if req.Recipient != "" {
-		req.Recipients = nil
-	}
+		default:
+			resp.ErrorCodes[i] = result.StatusCode
+		}
 
-	for i, n := 0, len(respParts)-1; i < n; i++ {
-		if len(respParts[i]) <= 3 {
-			// Seems like error code
-			resp.ErrorCodes[i], _ = strconv.Atoi(string(respParts[i]))
-		} else {
-			resp.IDs[i] = string(respParts[i])
-			resp.ErrorCodes[i] = STATUS_OK
+		resp.Results[i] = smsenderu.SendMessageResult{
+			Phone:      recipients[i],
+			ID:         resp.IDs[i],
+			ErrorCode:  resp.ErrorCodes[i],
+			StatusText: result.StatusText,
+			Cost:       result.Cost,
+			Segments:   result.SMS,
 		}
+		if resp.Results[i].StatusText == "" {
+			resp.Results[i].StatusText = StatusText(result.StatusCode)
+		}
+	}
+
+	if nMissing > 0 {
+		return resp, smsenderu.PartialFailure.New(s).
+			WithString("description", "Message has not been sent to some recipients.").
+			WithInt("failed_recipients", nMissing).
+			WithString("cause_class", missingErr.Class().FullName()).
+			Throw()
 	}
 
 	return resp, nil
@@ -290,6 +371,7 @@ func (q *senderSmsRu) Send(
 
 func (q *senderSmsRu) Cost(
 
+	ctx context.Context,
 	req *smsenderu.SendMessageRequest,
 ) (
 	resp *smsenderu.CostSendMessageResponse,
@@ -297,6 +379,8 @@ func (q *senderSmsRu) Cost(
 ) {
 	// https://sms.ru/api/cost
 	const s = "SMS.RU: Failed to get an info about cost of sending a message(s)."
+
+	whyInvalid := Validate(req)
 	switch {
 
 	case q == nil:
@@ -309,75 +393,119 @@ func (q *senderSmsRu) Cost(
 			WithString("description", "API token is not provided or empty.").
 			Throw()
 
-	case !sendMessageRequestIsValid(req):
+	case req != nil && (req.IsPing || req.IsHLR):
+		return nil, ekaerr.UnsupportedOperation.New(s).
+			WithString("description", "HLR lookup and ping-SMS are not supported by sms.ru Sender.").
+			WithBool("smsru_is_ping", req.IsPing).
+			WithBool("smsru_is_hlr", req.IsHLR).
+			Throw()
+
+	case len(whyInvalid) > 0:
 		return nil, ekaerr.IllegalArgument.New(s).
 			WithString("description", "Incorrect argument(s) of sending message request.").
-			WithString("smsru_cost_request_why_invalid", sendMessageRequestWhyInvalid(req)).
+			WithString("smsru_cost_request_why_invalid", whyInvalid.String()).
 			WithString("smsru_cost_request_dump", spew.Sdump(req)).
 			Throw()
 	}
 
-	const URL = "https://sms.ru/sms/cost"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
+	// Invalid phone numbers are reported per recipient
+	// and the cost is calculated for the rest of them.
+	recipients, invalid := parseRecipients(req)
+	switch {
 
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
+	case len(invalid) == len(recipients):
+		return nil, invalidRecipientsError(s, recipients, invalid).
+			Throw()
 
-	if req.Recipient != "" {
-		req.Recipients = []string{req.Recipient}
+	case len(invalid) > 0:
+		if resp, err = q.costValid(ctx, req, recipients, invalid); err.IsNotNil() {
+			return nil, err.
+				AddMessage(s).
+				Throw()
+		}
+		return resp, nil
+	}
+
+	if len(recipients) > MAX_RECIPIENTS {
+		if resp, err = smsenderu.CostChunked(ctx, req, MAX_RECIPIENTS, q.Cost); err.IsNotNil() {
+			return nil, err.
+				AddMessage(s).
+				Throw()
+		}
+		return resp, nil
 	}
 
-	fhReq.URI().QueryArgs().Add("to", strings.Join(req.Recipients, ","))
-	fhReq.URI().QueryArgs().Add("msg", req.Message)
+	const path = "/sms/cost"
+	args := q.args()
 
-	if req.From != "" {
-		fhReq.URI().QueryArgs().Add("from", req.From)
+	if len(req.Messages) == 0 {
+		args.Set("to", strings.Join(recipients, ","))
+		args.Set("msg", req.Message)
+
+	} else {
+		// See the comment about personalized messages in Send().
+		if hasDuplicates(recipients) {
+			return q.costEach(ctx, req)
+		}
+		for i, message := range req.AllMessages() {
+			args.Set(multiKey(recipients[i]), message)
+		}
+	}
+
+	if from := q.fromOf(req); from != "" {
+		args.Set("from", from)
 	}
 
 	if req.DoTransliterate {
-		fhReq.URI().QueryArgs().Add("translit", "1")
+		args.Set("translit", "1")
 	}
 
-	// Response contain an info about each phone number's sending message
-	// +1 more row (the current balance after sending).
+	var (
+		costResp = new(costResponse)
+		respBody []byte
+	)
 
-	var respParts [][]byte
-	respParts, err = q.do(fhReq, fhResp, 2)
-	if err.IsNotNil() {
+	if respBody, err = q.do(ctx, path, args, true, costResp); err.IsNotNil() {
 		return nil, err.
 			AddMessage(s).
 			Throw()
 	}
 
 	resp = &smsenderu.CostSendMessageResponse{
-		Costs: nil, // not supported by https://sms.ru/
-		Total: decimal.Zero,
+		Total:         costResp.TotalCost,
+		TotalSegments: costResp.TotalSMS,
 	}
 
-	// It's unnecessary but would even caller use SendMessageRequest object
-	// after that call?
-	if req.Recipient != "" {
-		req.Recipients = nil
+	// There is no cost per recipient in the text format response.
+	if len(costResp.SMS) == 0 {
+		return resp, nil
 	}
 
-	cost, legacyErr := decimal.NewFromString(string(respParts[0]))
-	if legacyErr != nil {
-		return nil, ekaerr.IllegalFormat.Wrap(legacyErr, s).
-			WithString("description", "Cannot decode the cost of sending message(s).").
-			WithString("smsru_cost_request_dump", spew.Sdump(req)).
-			WithString("smsru_cost_response_raw", ekastr.B2S(fhResp.Body())).
-			Throw()
+	resp.Costs = make([]decimal.Decimal, len(recipients))
+	resp.Segments = make([]int, len(recipients))
+	resp.ErrorCodes = make([]int, len(recipients))
+
+	for i, recipient := range recipients {
+		result := costResp.SMS[recipient]
+		if result == nil {
+			return nil, ekaerr.IllegalState.New(s).
+				WithString("description", "There is no cost of sending message to the phone number in the response.").
+				WithInt("smsru_recipient_index", i).
+				WithString("smsru_cost_response_raw", ekastr.B2S(respBody)).
+				Throw()
+		}
+		if result.StatusCode != STATUS_OK && result.StatusCode != 0 {
+			resp.ErrorCodes[i] = result.StatusCode
+		}
+		resp.Costs[i], resp.Segments[i] = result.Cost, result.SMS
 	}
 
-	resp.Total = cost
 	return resp, nil
 }
 
 func (q *senderSmsRu) Status(
 
+	ctx context.Context,
 	sentSmsId string,
 ) (
 	resp *smsenderu.StatusMessageResponse,
@@ -403,30 +531,94 @@ func (q *senderSmsRu) Status(
 			Throw()
 	}
 
-	const URL = "https://sms.ru/sms/status"
-	fhReq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(fhReq)
-	fhResp := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fhResp)
-
-	fhReq.SetRequestURI(URL)
-	fhReq.URI().QueryArgs().Add("api_id", q.token)
+	const path = "/sms/status"
+	args := q.args()
 
-	fhReq.URI().QueryArgs().Add("sms_id", sentSmsId)
+	args.Set("sms_id", sentSmsId)
 
-	var respParts [][]byte
-	respParts, err = q.do(fhReq, fhResp, 1)
-	if err.IsNotNil() {
+	statusResp := new(statusResponse)
+	if _, err = q.do(ctx, path, args, true, statusResp); err.IsNotNil() {
 		return nil, err.
 			AddMessage(s).
 			Throw()
 	}
 
-	resp = &smsenderu.StatusMessageResponse{
-		ID: sentSmsId,
+	return q.statusResponse(sentSmsId, statusResp.SMS[sentSmsId]), nil
+}
+
+// StatusBatch implements smsenderu.StatusBatcher.
+// IDs are requested by chunks of MAX_STATUS_IDS.
+func (q *senderSmsRu) StatusBatch(
+
+	ctx context.Context,
+	sentSmsIds []string,
+) (
+	resp []*smsenderu.StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	// https://sms.ru/api/status
+	const s = "SMS.RU: Failed to get an info about messages."
+	switch {
+
+	case q == nil:
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Invalid sender object. Did you use NewSender() constructor correctly?").
+			Throw()
+
+	case q.token == "":
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "API token is not provided or empty.").
+			Throw()
 	}
 
-	resp.ErrorCode, _ = strconv.Atoi(string(respParts[0]))
+	for i, sentSmsId := range sentSmsIds {
+		if sentSmsId == "" || strings.Contains(sentSmsId, ",") {
+			return nil, ekaerr.IllegalArgument.New(s).
+				WithString("description", "SMS ID is empty or malformed.").
+				WithInt("smsru_sms_id_index", i).
+				WithString("sms_id", sentSmsId).
+				Throw()
+		}
+	}
+
+	const path = "/sms/status"
+	resp = make([]*smsenderu.StatusMessageResponse, 0, len(sentSmsIds))
+
+	for from := 0; from < len(sentSmsIds); from += MAX_STATUS_IDS {
+		to := from + MAX_STATUS_IDS
+		if to > len(sentSmsIds) {
+			to = len(sentSmsIds)
+		}
+		chunk := sentSmsIds[from:to]
+
+		args := q.args()
+		args.Set("sms_id", strings.Join(chunk, ","))
+
+		statusResp := new(statusResponse)
+		if _, err = q.do(ctx, path, args, true, statusResp); err.IsNotNil() {
+			return nil, err.
+				AddMessage(s).
+				WithInt("smsru_sms_ids_from", from).
+				WithInt("smsru_sms_ids_to", to).
+				Throw()
+		}
+
+		for _, sentSmsId := range chunk {
+			resp = append(resp, q.statusResponse(sentSmsId, statusResp.SMS[sentSmsId]))
+		}
+	}
 
 	return resp, nil
 }
+
+// IsRetryableCode implements smsenderu.RetryableCoder.
+// The message may be sent to the recipient by another Sender
+// if sms.ru has been unavailable or the account has no money.
+func (q *senderSmsRu) IsRetryableCode(errorCode int) bool {
+	switch errorCode {
+	case ERROR_CODE_NOT_ENOUGH_MONEY, ERROR_CODE_TEMPORARY_UNAVAILABLE, ERROR_CODE_INTERNAL_SERVER_ERROR:
+		return true
+	default:
+		return false
+	}
+}
@@ -6,18 +6,63 @@
 package smsenderu_smsru
 
 import (
-	"strconv"
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/valyala/fasthttp"
 
 	"github.com/qioalice/ekago/v3/ekaerr"
 	"github.com/qioalice/ekago/v3/ekastr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/numplan"
 )
 
 type (
 	senderSmsRu struct {
-		fhc   fasthttp.Client
-		token string
+		transport smsenderu.Transport
+		token     string
+		baseURL   string
+		from      string
+		timeout   time.Duration
+		retry     RetryPolicy
+		numplan   *smsenderu_numplan.Plan
+		noNumplan bool
+		sent      *recipientsCache
+
+		textFormat bool
+	}
+
+	// recipientsCache is a bounded FIFO cache of recipients of sent messages
+	// by the messages' IDs, since sms.ru doesn't report a recipient in status.
+	recipientsCache struct {
+		mu    sync.Mutex
+		byID  map[string]string
+		order []string
+		next  int
+	}
+
+	// senderSmsRuConfig is a set of NewSender()'s options applied.
+	senderSmsRuConfig struct {
+		baseURL      string
+		from         string
+		transport    smsenderu.Transport
+		client       *fasthttp.Client
+		dial         fasthttp.DialFunc
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+		timeout      time.Duration
+		maxConns     int
+		maxRedirects int
+		retry        RetryPolicy
+		numplan      *smsenderu_numplan.Plan
+		noNumplan    bool
+		cacheSize    int
+		textFormat   bool
 	}
 )
 
@@ -70,6 +115,22 @@ const (
 	ERROR_CODE_CALLBACK_NOT_FOUND     = 902
 )
 
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// MAX_MESSAGE_SEGMENTS is the max number of SMS the message could be split into.
+	// Longer messages are rejected by sms.ru (ERROR_CODE_MESSAGE_BODY_TOO_LARGE).
+	MAX_MESSAGE_SEGMENTS = 8
+
+	// MAX_STATUS_IDS is the max number of message IDs sms.ru returns
+	// the statuses of in one request. StatusBatch() splits IDs into chunks.
+	MAX_STATUS_IDS = 100
+
+	// MAX_RECIPIENTS is the max number of recipients of one sending (or cost)
+	// request sms.ru accepts (ERROR_CODE_TOO_MUCH_PHONE_NUMBERS otherwise).
+	// Send() and Cost() split larger requests into chunks.
+	MAX_RECIPIENTS = 100
+)
+
 var (
 	statusCodeMeaningMap = map[int]string{
 		ERROR_CODE_MESSAGE_NOT_FOUND:                       "Message not found",
@@ -164,87 +225,550 @@ var (
 //901	Callback: URL неверный (не начинается на http://)
 //902	Callback: Обработчик не найден (возможно был удален ранее)
 
-func (q *senderSmsRu) do(
+func newSenderSmsRu(token string, options []Option) *senderSmsRu {
+
+	cfg := senderSmsRuConfig{
+		baseURL:      DefaultBaseURL,
+		maxRedirects: DefaultMaxRedirects,
+		cacheSize:    DefaultRecipientsCacheSize,
+	}
+
+	for _, option := range options {
+		if option != nil {
+			option(&cfg)
+		}
+	}
+
+	transport := cfg.transport
+	if transport == nil {
+		fhc := cfg.client
+		if fhc == nil {
+			fhc = &fasthttp.Client{
+				Dial:            cfg.dial,
+				ReadTimeout:     cfg.readTimeout,
+				WriteTimeout:    cfg.writeTimeout,
+				MaxConnsPerHost: cfg.maxConns,
+			}
+		}
+		transport = smsenderu.NewFastHTTPTransport(fhc, cfg.maxRedirects)
+	}
+
+	return &senderSmsRu{
+		transport: transport,
+		token:     token,
+		baseURL:   cfg.baseURL,
+		from:      cfg.from,
+		timeout:   cfg.timeout,
+		retry:     cfg.retry,
+		numplan:   cfg.numplan,
+		noNumplan: cfg.noNumplan,
+		sent:      newRecipientsCache(cfg.cacheSize),
+
+		textFormat: cfg.textFormat,
+	}
+}
 
-	fhReq *fasthttp.Request,
-	fhResp *fasthttp.Response,
-	requiredParts int,
+// numberingPlan returns a numbering plan that is used to fill
+// the operator and the region of recipient, or nil if it's disabled.
+func (q *senderSmsRu) numberingPlan() *smsenderu_numplan.Plan {
+	switch {
+	case q.noNumplan:
+		return nil
+	case q.numplan != nil:
+		return q.numplan
+	default:
+		return smsenderu_numplan.Default()
+	}
+}
+
+// statusResponse returns StatusMessageResponse of the message with provided ID
+// and its sms.ru status, filling its recipient and their info if they are known.
+// Message is treated as not found if there is no status.
+func (q *senderSmsRu) statusResponse(sentSmsId string, result *smsResult) *smsenderu.StatusMessageResponse {
+
+	resp := &smsenderu.StatusMessageResponse{
+		ID:         sentSmsId,
+		ErrorCode:  ERROR_CODE_MESSAGE_NOT_FOUND,
+		StatusText: StatusText(ERROR_CODE_MESSAGE_NOT_FOUND),
+		Recipient:  q.sent.get(sentSmsId),
+	}
+
+	if result != nil {
+		resp.ErrorCode, resp.StatusText = result.StatusCode, result.StatusText
+		if resp.StatusText == "" {
+			resp.StatusText = StatusText(resp.ErrorCode)
+		}
+	}
+
+	resp.NotFound = resp.ErrorCode == ERROR_CODE_MESSAGE_NOT_FOUND
+
+	if plan := q.numberingPlan(); plan != nil && resp.Recipient != "" {
+		if info, ok := plan.LookupString(resp.Recipient); ok {
+			resp.Country, resp.Region, resp.Operator = info.Country, info.Region, info.Operator
+		}
+	}
+
+	return resp
+}
+
+// sendSplit sends SendMessageRequest to its valid recipients by the chunks
+// of chunkSize recipients (one by one if it's 1, see smsenderu.SendEach(),
+// smsenderu.SendChunked()). recipients and invalid are the results
+// of parseRecipients(), the invalid recipients are reported
+// as ERROR_CODE_BAD_PHONE_NUMBER and are not sent at all.
+// The response is returned along with an error of smsenderu.PartialFailure class
+// if some chunks have failed.
+func (q *senderSmsRu) sendSplit(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+	recipients []string,
+	invalid map[int]ekaerr.Class,
+	chunkSize int,
 ) (
-	parts [][]byte,
+	resp *smsenderu.SendMessageResponse,
 	err *ekaerr.Error,
 ) {
-	const s = "SMS.RU: Failed to perform remote HTTP request."
+	sent := make([]int, 0, len(recipients)-len(invalid))
+	for i := range recipients {
+		if _, isInvalid := invalid[i]; !isInvalid {
+			sent = append(sent, i)
+		}
+	}
+
+	validReq := *req
+	validReq.Recipient, validReq.Recipients = "", make([]string, len(sent))
+	if len(req.Messages) > 0 {
+		validReq.Messages = make([]string, len(sent))
+	}
+	for j, i := range sent {
+		validReq.Recipients[j] = recipients[i]
+		if len(req.Messages) > 0 {
+			validReq.Messages[j] = req.Messages[i]
+		}
+	}
 
-	legacyErr := q.fhc.DoRedirects(fhReq, fhResp, 5)
-	if legacyErr != nil {
-		return nil, ekaerr.ServiceUnavailable.Wrap(legacyErr, s).
+	var validResp *smsenderu.SendMessageResponse
+	if chunkSize == 1 {
+		validResp, err = smsenderu.SendEach(ctx, &validReq, q.Send)
+	} else {
+		validResp, err = smsenderu.SendChunked(ctx, &validReq, chunkSize, q.Send)
+	}
+	if validResp == nil {
+		return nil, err.
 			Throw()
 	}
 
-	if httpCode := fhResp.StatusCode(); httpCode != fasthttp.StatusOK {
-		return nil, ekaerr.RejectedOperation.New(s).
-			WithString("description", "API response finished with other than HTTP 200 status code.").
-			WithInt("smsru_response_http_code", httpCode).
+	resp = &smsenderu.SendMessageResponse{
+		IDs:        make([]string, len(recipients)),
+		ErrorCodes: make([]int, len(recipients)),
+		Balance:    validResp.Balance,
+	}
+	if validResp.Results != nil {
+		resp.Results = make([]smsenderu.SendMessageResult, len(recipients))
+	}
+
+	for j, i := range sent {
+		resp.IDs[i], resp.ErrorCodes[i] = validResp.IDs[j], validResp.ErrorCodes[j]
+		if resp.Results != nil {
+			resp.Results[i] = validResp.Results[j]
+		}
+	}
+
+	markInvalidRecipients(resp, recipients, invalid)
+	return resp, err.
+		Throw()
+}
+
+// markInvalidRecipients reports ERROR_CODE_BAD_PHONE_NUMBER
+// for the invalid recipients in SendMessageResponse.
+func markInvalidRecipients(
+
+	resp *smsenderu.SendMessageResponse,
+	recipients []string,
+	invalid map[int]ekaerr.Class,
+) {
+	for i := range invalid {
+		resp.ErrorCodes[i] = ERROR_CODE_BAD_PHONE_NUMBER
+		if resp.Results != nil {
+			resp.Results[i] = smsenderu.SendMessageResult{
+				Phone:      recipients[i],
+				ErrorCode:  ERROR_CODE_BAD_PHONE_NUMBER,
+				StatusText: StatusText(ERROR_CODE_BAD_PHONE_NUMBER),
+			}
+		}
+	}
+}
+
+// multiKey returns the sms.ru API argument's name of the personalized message
+// for the recipient.
+func multiKey(recipient string) string {
+	return "multi[" + recipient + "]"
+}
+
+// costValid returns the cost of sending message to the valid recipients
+// of SendMessageRequest, reporting ERROR_CODE_BAD_PHONE_NUMBER for the invalid ones.
+// recipients and invalid are the results of parseRecipients().
+func (q *senderSmsRu) costValid(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+	recipients []string,
+	invalid map[int]ekaerr.Class,
+) (
+	resp *smsenderu.CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	valid := make([]int, 0, len(recipients)-len(invalid))
+	for i := range recipients {
+		if _, isInvalid := invalid[i]; !isInvalid {
+			valid = append(valid, i)
+		}
+	}
+
+	subReq := *req
+	subReq.Recipient, subReq.Recipients = "", make([]string, len(valid))
+	if len(req.Messages) > 0 {
+		subReq.Messages = make([]string, len(valid))
+	}
+	for j, i := range valid {
+		subReq.Recipients[j] = recipients[i]
+		if subReq.Messages != nil {
+			subReq.Messages[j] = req.Messages[i]
+		}
+	}
+
+	var subResp *smsenderu.CostSendMessageResponse
+	if subResp, err = q.Cost(ctx, &subReq); err.IsNotNil() {
+		return nil, err.
 			Throw()
 	}
 
+	resp = &smsenderu.CostSendMessageResponse{
+		Total:         subResp.Total,
+		TotalSegments: subResp.TotalSegments,
+		ErrorCodes:    make([]int, len(recipients)),
+	}
+
+	if len(subResp.Costs) == len(valid) {
+		resp.Costs = make([]decimal.Decimal, len(recipients))
+	}
+	if len(subResp.Segments) == len(valid) {
+		resp.Segments = make([]int, len(recipients))
+	}
+
+	for j, i := range valid {
+		if resp.Costs != nil {
+			resp.Costs[i] = subResp.Costs[j]
+		}
+		if resp.Segments != nil {
+			resp.Segments[i] = subResp.Segments[j]
+		}
+		if len(subResp.ErrorCodes) == len(valid) {
+			resp.ErrorCodes[i] = subResp.ErrorCodes[j]
+		}
+	}
+
+	for i := range invalid {
+		resp.ErrorCodes[i] = ERROR_CODE_BAD_PHONE_NUMBER
+	}
+
+	return resp, nil
+}
+
+// costEach returns the cost of personalized messages of SendMessageRequest
+// requesting it for each of them one by one.
+// Costs (Segments) of the response are nil if at least one response has no them.
+func (q *senderSmsRu) costEach(
+
+	ctx context.Context,
+	req *smsenderu.SendMessageRequest,
+) (
+	resp *smsenderu.CostSendMessageResponse,
+	err *ekaerr.Error,
+) {
+	recipients := req.AllRecipients()
+
+	resp = &smsenderu.CostSendMessageResponse{
+		Costs:      make([]decimal.Decimal, len(recipients)),
+		Total:      decimal.Zero,
+		Segments:   make([]int, len(recipients)),
+		ErrorCodes: make([]int, len(recipients)),
+	}
+
+	for i, recipient := range recipients {
+
+		subReq := *req
+		subReq.Recipient, subReq.Recipients = recipient, nil
+		subReq.Message, subReq.Messages = req.Messages[i], nil
+
+		var subResp *smsenderu.CostSendMessageResponse
+		if subResp, err = q.Cost(ctx, &subReq); err.IsNotNil() {
+			return nil, err.
+				WithInt("smsru_recipient_index", i).
+				Throw()
+		}
+
+		resp.Total = resp.Total.Add(subResp.Total)
+		resp.TotalSegments += subResp.TotalSegments
+
+		if resp.Costs != nil && len(subResp.Costs) == 1 {
+			resp.Costs[i] = subResp.Costs[0]
+		} else {
+			resp.Costs = nil
+		}
+
+		if resp.Segments != nil && len(subResp.Segments) == 1 {
+			resp.Segments[i] = subResp.Segments[0]
+		} else {
+			resp.Segments = nil
+		}
+
+		if len(subResp.ErrorCodes) == 1 {
+			resp.ErrorCodes[i] = subResp.ErrorCodes[0]
+		}
+	}
+
+	return resp, nil
+}
+
+// hasDuplicates reports whether some of recipients have the same phone number.
+func hasDuplicates(recipients []string) bool {
+	seen := make(map[string]struct{}, len(recipients))
+	for _, recipient := range recipients {
+		if _, ok := seen[recipient]; ok {
+			return true
+		}
+		seen[recipient] = struct{}{}
+	}
+	return false
+}
+
+// newRecipientsCache returns a new recipientsCache of provided size,
+// or nil if size is not positive.
+func newRecipientsCache(size int) *recipientsCache {
+	if size <= 0 {
+		return nil
+	}
+	return &recipientsCache{
+		byID:  make(map[string]string, size),
+		order: make([]string, size),
+	}
+}
+
+// add saves the recipient of the message with provided ID,
+// evicting the oldest one if cache is full. Nil safe.
+func (q *recipientsCache) add(id, recipient string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if evicted := q.order[q.next]; evicted != "" {
+		delete(q.byID, evicted)
+	}
+	q.order[q.next], q.byID[id] = id, recipient
+	q.next = (q.next + 1) % len(q.order)
+}
+
+// get returns the recipient of the message with provided ID,
+// or an empty string if it's unknown. Nil safe.
+func (q *recipientsCache) get(id string) string {
+	if q == nil {
+		return ""
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.byID[id]
+}
+
+// args returns a new set of sms.ru API request's arguments
+// with already added API token.
+func (q *senderSmsRu) args() url.Values {
+	args := make(url.Values, 8)
+	args.Set("api_id", q.token)
+	return args
+}
+
+// fromOf returns SendMessageRequest's sender or the default one
+// if it's not presented.
+func (q *senderSmsRu) fromOf(req *smsenderu.SendMessageRequest) string {
+	if req.From != "" {
+		return req.From
+	}
+	return q.from
+}
+
+// do performs sms.ru API request retrying it according to RetryPolicy,
+// and decodes its response to resp. Returns the raw response body.
+// idempotent must be false for the requests that must not be repeated
+// after ambiguous failure (like sending a message).
+func (q *senderSmsRu) do(
+
+	ctx context.Context,
+	path string,
+	args url.Values,
+	idempotent bool,
+	resp response,
+) (
+	raw []byte,
+	err *ekaerr.Error,
+) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if q.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.timeout)
+		defer cancel()
+	}
+
+	if !q.textFormat {
+		args.Set("json", "1")
+	}
+
 	var (
-		statusCode        int
-		statusCodeMeaning = "<UnknownStatus>"
+		kind   retryKind
+		causes []string
 	)
 
-	statusCode, parts = q.decodeResponse(fhResp.Body())
-	if statusCode == 0 {
-		return nil, ekaerr.IllegalFormat.New(s).
-			WithString("description", "Failed to decode API response. It is empty or without status.").
-			WithString("smsru_response_raw", ekastr.B2S(fhResp.Body())).
-			Throw()
-	}
+	for attempt := 1; ; attempt++ {
 
-	if statusCode != STATUS_OK {
-		if statusCodeMeaning_, ok := statusCodeMeaningMap[statusCode]; ok {
-			statusCodeMeaning = statusCodeMeaning_
+		if raw, kind, err = q.doOnce(ctx, path, args, resp); err.IsNil() {
+			return raw, nil
+		}
+
+		causes = append(causes, err.Class().FullName())
+
+		if attempt >= q.retry.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		if !q.retry.canRetry(kind, idempotent) {
+			if kind == retryAmbiguous {
+				err = err.WithBool("smsru_retry_skipped_ambiguous", true)
+			}
+			break
+		}
+
+		if !sleep(ctx, q.retry.backoff(attempt)) {
+			break
 		}
-		return nil, ekaerr.IllegalFormat.New(s).
-			WithString("description", "API response finished with not OK code.").
-			WithInt("smsru_response_status_code", statusCode).
-			WithString("smsru_response_status_code_meaning", statusCodeMeaning).
-			WithString("smsru_response_raw", ekastr.B2S(fhResp.Body())).
-			Throw()
 	}
 
-	if len(parts) < requiredParts {
-		return nil, ekaerr.IllegalFormat.New(s).
-			WithString("description", "Failed to decode API response. Unexpected number of parts.").
-			WithInt("smsru_response_required_parts", requiredParts).
-			WithInt("smsru_response_got_parts", len(parts)).
-			WithString("smsru_response_raw", ekastr.B2S(fhResp.Body())).
-			Throw()
+	if q.retry.MaxAttempts > 1 {
+		err = err.
+			WithInt("smsru_retry_attempts", len(causes)).
+			WithArray("smsru_retry_causes", causes)
 	}
 
-	return parts, nil
+	return nil, err.
+		Throw()
 }
 
-func (q *senderSmsRu) decodeResponse(b []byte) (statusCode int, parts [][]byte) {
+// doOnce performs sms.ru API request once and decodes its response to resp,
+// or returns an error and the kind of that error in terms of retrying.
+func (q *senderSmsRu) doOnce(
+
+	ctx context.Context,
+	path string,
+	args url.Values,
+	resp response,
+) (
+	raw []byte,
+	kind retryKind,
+	err *ekaerr.Error,
+) {
+	const s = "SMS.RU: Failed to perform remote HTTP request."
+
+	if q.retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.retry.AttemptTimeout)
+		defer cancel()
+	}
 
-	n := len(b)
-	if n == 0 {
-		return 0, nil
+	req := &smsenderu.TransportRequest{
+		URL:   q.baseURL + path,
+		Query: args,
 	}
 
-	parts = make([][]byte, 0, 16)
+	transportResp, err := q.transport.Do(ctx, req)
+	if err.IsNotNil() {
+		// The request might have been sent before the failure.
+		return nil, retryAmbiguous, err.
+			AddMessage(s).
+			Throw()
+	}
 
-	for i := 0; i < n; i++ {
-		j := i
-		for ; i < n && b[i] != '\n'; i++ {
+	if transportResp.StatusCode != http.StatusOK {
+		cls := ekaerr.RejectedOperation
+		switch {
+		case transportResp.StatusCode == http.StatusTooManyRequests:
+			kind = retrySafe
+		case transportResp.StatusCode == http.StatusServiceUnavailable:
+			cls, kind = smsenderu.ProviderUnavailable, retrySafe
+		case transportResp.StatusCode >= http.StatusInternalServerError:
+			cls, kind = smsenderu.ProviderUnavailable, retryAmbiguous
 		}
-		parts = append(parts, b[j:i])
+		return nil, kind, cls.New(s).
+			WithString("description", "API response finished with other than HTTP 200 status code.").
+			WithInt("smsru_response_http_code", transportResp.StatusCode).
+			Throw()
 	}
 
-	statusCodePart := parts[0]
-	parts = parts[1:]
+	raw = transportResp.Body
 
-	statusCode, _ = strconv.Atoi(string(statusCodePart))
+	statusCode := decodeResponse(raw, args, resp)
+	if statusCode == 0 {
+		return nil, retryNever, ekaerr.IllegalFormat.New(s).
+			WithString("description", "Failed to decode API response. It is empty, malformed or without status.").
+			WithString("smsru_response_raw", ekastr.B2S(raw)).
+			Throw()
+	}
 
-	return statusCode, parts
+	if statusCode != STATUS_OK {
+		statusText := resp.status().StatusText
+		if statusText == "" {
+			statusText = StatusText(statusCode)
+		}
+		if statusText == "" {
+			statusText = "<UnknownStatus>"
+		}
+		return nil, retryKindOf(statusCode), errorClassOf(statusCode).New(s).
+			WithString("description", "API response finished with not OK code.").
+			WithInt("smsru_response_status_code", statusCode).
+			WithString("smsru_response_status_code_meaning", statusText).
+			WithString("smsru_response_raw", ekastr.B2S(raw)).
+			Throw()
+	}
+
+	return raw, retryNever, nil
+}
+
+// retryKindOf returns the kind of not OK sms.ru API's status code
+// in terms of retrying.
+func retryKindOf(statusCode int) retryKind {
+	switch statusCode {
+	case ERROR_CODE_TEMPORARY_UNAVAILABLE:
+		return retrySafe
+	case ERROR_CODE_INTERNAL_SERVER_ERROR:
+		return retryAmbiguous
+	default:
+		return retryNever
+	}
+}
+
+// errorClassOf returns an error class of not OK sms.ru API's status code.
+// Server side failures and insufficient funds are reported
+// using smsenderu's provider independent classes.
+func errorClassOf(statusCode int) ekaerr.Class {
+	switch statusCode {
+	case ERROR_CODE_TEMPORARY_UNAVAILABLE, ERROR_CODE_INTERNAL_SERVER_ERROR:
+		return smsenderu.ProviderUnavailable
+	case ERROR_CODE_NOT_ENOUGH_MONEY:
+		return smsenderu.NotEnoughMoney
+	default:
+		return ekaerr.IllegalFormat
+	}
 }
@@ -6,51 +6,83 @@
 package smsenderu_smsru_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
 
+	"github.com/qioalice/ekago/v3/ekaerr"
 	"github.com/qioalice/ekago/v3/ekalog"
+	"github.com/qioalice/ekago/v3/ekatime"
 
 	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/numplan"
+	"github.com/qioalice/smsenderu/sendertest"
 	"github.com/qioalice/smsenderu/services/sms.ru"
+	"github.com/qioalice/smsenderu/services/sms.ru/smsrutest"
 )
 
 const (
 	//==============================================================================//
-	TOKEN = `< place your token here >`
+	TOKEN = `test-token`
+	PHONE = `79123456789`
 
 //==============================================================================//
 )
 
+// newTestSender starts a fake sms.ru API server and returns it
+// with the Sender that is bound to that server.
+func newTestSender(t *testing.T) (*smsenderu_smsrutest.Server, smsenderu.Sender) {
+	srv := smsenderu_smsrutest.NewServer(TOKEN)
+	t.Cleanup(srv.Close)
+	return srv, smsenderu_smsru.NewSender(TOKEN, smsenderu_smsru.WithBaseURL(srv.URL()))
+}
+
 func TestSenderSmsRu_Check(t *testing.T) {
-	q := smsenderu_smsru.NewSender(TOKEN)
-	err := q.Check()
+	_, q := newTestSender(t)
+	err := q.Check(context.Background())
 	ekalog.Errore("Failed to check SMS.RU credentials.", err)
 	require.True(t, err.IsNil())
 }
 
+func TestSenderSmsRu_CheckIncorrectToken(t *testing.T) {
+	srv, _ := newTestSender(t)
+	q := smsenderu_smsru.NewSender("incorrect-token", smsenderu_smsru.WithBaseURL(srv.URL()))
+	err := q.Check(context.Background())
+	require.True(t, err.IsNotNil())
+}
+
 func TestSenderSmsRu_Balance(t *testing.T) {
 	//==============================================================================//
 	expectedBalance := decimal.New(10, 0)
 	//expectedBalance := decimal.NewFromString("10.0")
 	//==============================================================================//
-	q := smsenderu_smsru.NewSender(TOKEN)
-	balance, currency, err := q.Balance()
+	srv, q := newTestSender(t)
+	srv.SetBalance(expectedBalance)
+	balance, currency, err := q.Balance(context.Background())
 	ekalog.Errore("Failed to check SMS.RU balance.", err)
 	require.True(t, err.IsNil())
 	require.EqualValues(t, "RUB", currency)
-	require.EqualValues(t, expectedBalance.String(), balance.String())
+	require.True(t, expectedBalance.Equal(balance))
 }
 
 func TestSenderSmsRu_Senders(t *testing.T) {
 	//==============================================================================//
-	expectedSenders := []string{"< place your phone number here >"} // <--- EDIT ME
+	expectedSenders := []string{"MyShop", "MyShopPromo"}
 	//==============================================================================//
-	q := smsenderu_smsru.NewSender(TOKEN)
-	senders, err := q.Senders()
+	srv, q := newTestSender(t)
+	srv.SetSenders(expectedSenders...)
+	senders, err := q.Senders(context.Background())
 	ekalog.Errore("Failed to get SMS.RU senders.", err)
 	require.True(t, err.IsNil())
 	spew.Dump(senders)
@@ -60,44 +92,868 @@ func TestSenderSmsRu_Senders(t *testing.T) {
 func TestSenderSmsRu_Send(t *testing.T) {
 	//==============================================================================//
 	req := &smsenderu.SendMessageRequest{
-		Recipient: "< place your phone number here >", // <--- EDIT ME
+		Recipient: PHONE,
 		Message:   "UTF-8 日本語 тест\nCode: 1234",
 	}
 	//==============================================================================//
-	q := smsenderu_smsru.NewSender(TOKEN)
-	resp, err := q.Send(req)
+	srv, q := newTestSender(t)
+	resp, err := q.Send(context.Background(), req)
 	ekalog.Errore("Failed to send a message using SMS.RU.", err)
 	require.True(t, err.IsNil())
 	require.NotNil(t, resp)
 	require.Len(t, resp.IDs, 1)
-	require.Len(t, resp.IDs, 1)
+	require.Len(t, resp.ErrorCodes, 1)
 	require.EqualValues(t, smsenderu_smsru.STATUS_OK, resp.ErrorCodes[0])
 	ekalog.Debug("Send SMS ID: %s", resp.IDs[0])
+
+	messages := srv.MessagesTo(PHONE)
+	require.Len(t, messages, 1)
+	require.EqualValues(t, resp.IDs[0], messages[0].ID)
+	require.EqualValues(t, req.Message, messages[0].Text)
+}
+
+func TestSenderSmsRu_SendPartialFailure(t *testing.T) {
+	//==============================================================================//
+	const badPhone = "79000000000"
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, badPhone},
+		Message:    "Code: 1234",
+	}
+	//==============================================================================//
+	srv, q := newTestSender(t)
+	srv.SetPhoneError(badPhone, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER)
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 2)
+	require.Len(t, resp.ErrorCodes, 2)
+	require.EqualValues(t, smsenderu_smsru.STATUS_OK, resp.ErrorCodes[0])
+	require.NotEmpty(t, resp.IDs[0])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[1])
+	require.Empty(t, resp.IDs[1])
+	require.Len(t, srv.Messages(), 1)
+}
+
+func TestSenderSmsRu_SendInvalidPhone(t *testing.T) {
+	//==============================================================================//
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"8 (912) 345-67-89", "+7 012 345 67 89", "phone"},
+		Message:    "Code: 1234",
+	}
+	//==============================================================================//
+	srv, q := newTestSender(t)
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 3)
+	require.NotEmpty(t, resp.IDs[0])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[1])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[2])
+	require.Len(t, srv.MessagesTo(PHONE), 1)
+
+	req.Recipients = req.Recipients[1:]
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+
+	_, err = q.Cost(context.Background(), req)
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.EqualValues(t, 1, srv.Calls("/sms/send"))
+	require.EqualValues(t, 0, srv.Calls("/sms/cost"))
+}
+
+func TestSenderSmsRu_SendSplitInvalidPhone(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	// The same phone number twice makes the request split.
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, PHONE, "phone"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 3)
+	require.NotEmpty(t, resp.IDs[0])
+	require.NotEmpty(t, resp.IDs[1])
+	require.Empty(t, resp.IDs[2])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[2])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.Results[2].ErrorCode)
+	require.EqualValues(t, 2, srv.Calls("/sms/send"))
+
+	// The whole chunk of invalid phone numbers.
+	recipients := make([]string, 150)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("7912%07d", i)
+		if i < smsenderu_smsru.MAX_RECIPIENTS {
+			recipients[i] = "phone"
+		}
+	}
+	resp, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, len(recipients))
+	for i := range recipients {
+		if i < smsenderu_smsru.MAX_RECIPIENTS {
+			require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[i])
+		} else {
+			require.NotEmpty(t, resp.IDs[i])
+		}
+	}
+	require.EqualValues(t, 3, srv.Calls("/sms/send"))
+}
+
+func TestSenderSmsRu_SendMissingRecipient(t *testing.T) {
+	// The response has no result of the second recipient.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"status":"OK","status_code":100,"sms":{"%s":`+
+			`{"status":"OK","status_code":100,"sms_id":"000000-0000001","cost":"1.50","sms":1}},"balance":10.00}`, PHONE)
+	}))
+	t.Cleanup(srv.Close)
+
+	q := smsenderu_smsru.NewSender(TOKEN, smsenderu_smsru.WithBaseURL(srv.URL))
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, "79123456780"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.Is(smsenderu.PartialFailure))
+	require.NotNil(t, resp)
+	require.EqualValues(t, "000000-0000001", resp.IDs[0])
+	require.EqualValues(t, smsenderu_smsru.STATUS_OK, resp.ErrorCodes[0])
+	require.Empty(t, resp.IDs[1])
+	require.EqualValues(t, smsenderu.ERROR_CODE_NOT_SENT, resp.ErrorCodes[1])
+	require.EqualValues(t, "79123456780", resp.Results[1].Phone)
+	require.True(t, resp.Results[1].Err.Is(ekaerr.IllegalState))
+}
+
+func TestSenderSmsRu_SendServerError(t *testing.T) {
+	req := &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   "Code: 1234",
+	}
+	srv, q := newTestSender(t)
+	srv.SetMethodError("/sms/send", smsenderu_smsru.ERROR_CODE_TEMPORARY_UNAVAILABLE)
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.Is(smsenderu.ProviderUnavailable))
+	require.Nil(t, resp)
+	require.Empty(t, srv.Messages())
+}
+
+func TestSenderSmsRu_SendResults(t *testing.T) {
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"+7 (912) 345-67-89", "79123456780", "123"},
+		Message:    strings.Repeat("a", 161),
+	}
+
+	srv, q := newTestSender(t)
+	srv.SetBalance(decimal.New(100, 0))
+	srv.SetCostPerSms(decimal.New(150, -2))
+	srv.SetPhoneError("79123456780", smsenderu_smsru.ERROR_CODE_SPAM_DETECTED)
+
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.Results, 3)
+
+	require.EqualValues(t, "79123456789", resp.Results[0].Phone)
+	require.EqualValues(t, resp.IDs[0], resp.Results[0].ID)
+	require.EqualValues(t, smsenderu_smsru.STATUS_OK, resp.Results[0].ErrorCode)
+	require.NotEmpty(t, resp.Results[0].StatusText)
+	require.EqualValues(t, "3", resp.Results[0].Cost.String())
+	require.EqualValues(t, 2, resp.Results[0].Segments)
+
+	require.Empty(t, resp.Results[1].ID)
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_SPAM_DETECTED, resp.Results[1].ErrorCode)
+	require.EqualValues(t, smsenderu_smsru.StatusText(smsenderu_smsru.ERROR_CODE_SPAM_DETECTED), resp.Results[1].StatusText)
+
+	require.EqualValues(t, "123", resp.Results[2].Phone)
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.Results[2].ErrorCode)
+
+	require.NotNil(t, resp.Balance)
+	require.EqualValues(t, "97", resp.Balance.String())
+
+	// The text format has the balance but no cost per recipient.
+	srv.SetTextOnly(true)
+	resp, err = q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, resp.IDs[0], resp.Results[0].ID)
+	require.True(t, resp.Results[0].Cost.IsZero())
+	require.EqualValues(t, "94", resp.Balance.String())
+}
+
+func TestSenderSmsRu_SendSharedRequest(t *testing.T) {
+	sendAt := ekatime.NewTimestampNow() - ekatime.SECONDS_IN_HOUR
+	newRequests := func() []*smsenderu.SendMessageRequest {
+		recipients := make([]string, 150)
+		messages := make([]string, len(recipients))
+		for i := range recipients {
+			recipients[i] = fmt.Sprintf("7912%07d", i)
+			messages[i] = fmt.Sprintf("Code: %04d", i)
+		}
+		return []*smsenderu.SendMessageRequest{
+			{
+				Recipient: "+7 912 345-67-89",
+				Message:   "Code: 1234",
+				SendAt:    sendAt,
+			},
+			{
+				Recipients: recipients,
+				Messages:   messages,
+			},
+		}
+	}
+
+	srv, q := newTestSender(t)
+	srv.SetBalance(decimal.New(100000, 0))
+
+	reqs, expected := newRequests(), newRequests()
+
+	// Run with -race to be sure that the shared requests are read only.
+	var wg sync.WaitGroup
+	errs := make(chan *ekaerr.Error, 4*2*len(reqs))
+	for i := 0; i < 4; i++ {
+		for _, req := range reqs {
+			wg.Add(2)
+			go func(req *smsenderu.SendMessageRequest) {
+				defer wg.Done()
+				_, err := q.Send(context.Background(), req)
+				errs <- err
+			}(req)
+			go func(req *smsenderu.SendMessageRequest) {
+				defer wg.Done()
+				_, err := q.Cost(context.Background(), req)
+				errs <- err
+			}(req)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.True(t, err.IsNil())
+	}
+
+	require.Equal(t, expected, reqs, "Send() and Cost() must not change the request")
+}
+
+func TestSenderSmsRu_CostInvalidPhone(t *testing.T) {
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"8 (912) 345-67-89", "phone", "79123456780"},
+		Messages:   []string{"Hello", "Hello, phone", strings.Repeat("a", 161)},
+	}
+
+	srv, q := newTestSender(t)
+	srv.SetCostPerSms(decimal.New(150, -2))
+
+	resp, err := q.Cost(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, []int{0, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, 0}, resp.ErrorCodes)
+	require.Len(t, resp.Costs, 3)
+	require.EqualValues(t, "1.5", resp.Costs[0].String())
+	require.True(t, resp.Costs[1].IsZero())
+	require.EqualValues(t, "3", resp.Costs[2].String())
+	require.EqualValues(t, []int{1, 0, 2}, resp.Segments)
+	require.EqualValues(t, "4.5", resp.Total.String())
+	require.EqualValues(t, 1, srv.Calls("/sms/cost"))
+}
+
+func TestSenderSmsRu_CostMissingRecipient(t *testing.T) {
+	// The response has no cost of the second recipient.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"status":"OK","status_code":100,"sms":{"%s":`+
+			`{"status":"OK","status_code":100,"cost":"1.50","sms":1}},"total_cost":3.00,"total_sms":2}`, PHONE)
+	}))
+	t.Cleanup(srv.Close)
+
+	q := smsenderu_smsru.NewSender(TOKEN, smsenderu_smsru.WithBaseURL(srv.URL))
+	_, err := q.Cost(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, "79123456780"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.Is(ekaerr.IllegalState))
 }
 
 func TestSenderSmsRu_Cost(t *testing.T) {
 	//==============================================================================//
 	req := &smsenderu.SendMessageRequest{
-		Recipient: "< place your phone number here >", // <--- EDIT ME
+		Recipient: PHONE,
 		Message:   "UTF-8 日本語 тест\nCode: 1234",
 	}
 	//==============================================================================//
-	q := smsenderu_smsru.NewSender(TOKEN)
-	resp, err := q.Cost(req)
+	srv, q := newTestSender(t)
+	srv.SetCostPerSms(decimal.New(250, -2))
+	resp, err := q.Cost(context.Background(), req)
 	ekalog.Errore("Failed to get a cost of sending message(s) using SMS.RU.", err)
 	require.True(t, err.IsNil())
 	require.NotNil(t, resp)
+	require.EqualValues(t, "2.5", resp.Total.String())
 	ekalog.Debug("Cost of SMS sending %s RUB", resp.Total)
 }
 
+func TestSenderSmsRu_CostPerRecipient(t *testing.T) {
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, "79123456780"},
+		Messages:   []string{"Hello", strings.Repeat("a", 161)},
+	}
+
+	srv, q := newTestSender(t)
+	srv.SetCostPerSms(decimal.New(150, -2))
+
+	resp, err := q.Cost(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.Costs, 2)
+	require.EqualValues(t, "1.5", resp.Costs[0].String())
+	require.EqualValues(t, "3", resp.Costs[1].String())
+	require.EqualValues(t, "4.5", resp.Total.String())
+	require.EqualValues(t, []int{1, 2}, resp.Segments)
+	require.EqualValues(t, 3, resp.TotalSegments)
+
+	// The same phone twice is requested one by one.
+	req.Recipients = []string{PHONE, PHONE}
+	resp, err = q.Cost(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, []int{1, 2}, resp.Segments)
+	require.EqualValues(t, "4.5", resp.Total.String())
+
+	// There is no cost per recipient in the text format.
+	srv.SetTextOnly(true)
+	resp, err = q.Cost(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Nil(t, resp.Costs)
+	require.Nil(t, resp.Segments)
+	require.EqualValues(t, 3, resp.TotalSegments)
+	require.EqualValues(t, "4.5", resp.Total.String())
+}
+
 func TestSenderSmsRu_Status(t *testing.T) {
 	//==============================================================================//
-	sentSmsId := "202041-1000004"
+	req := &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   "Code: 1234",
+	}
+	expectedStatuses := []int{
+		smsenderu_smsru.STATUS_PENDING,
+		smsenderu_smsru.STATUS_DELIVERED,
+		smsenderu_smsru.STATUS_DELIVERED,
+	}
 	//==============================================================================//
+	plan, err := smsenderu_numplan.Parse(strings.NewReader(
+		"912;0000000;9999999;10000000;ПАО \"Мобильные ТелеСистемы\";Свердловская обл.;7740000076\n",
+	))
+	require.True(t, err.IsNil())
+
+	srv, q := newTestSender(t)
+	qWithPlan := smsenderu_smsru.NewSender(TOKEN,
+		smsenderu_smsru.WithBaseURL(srv.URL()),
+		smsenderu_smsru.WithNumberingPlan(plan),
+	)
+	srv.SetStatusFlow(smsenderu_smsru.STATUS_PENDING, smsenderu_smsru.STATUS_DELIVERED)
+	sendResp, err := qWithPlan.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	sentSmsId := sendResp.IDs[0]
+	for _, expectedStatus := range expectedStatuses {
+		resp, err := qWithPlan.Status(context.Background(), sentSmsId)
+		ekalog.Errore("Failed to get an info about sent message using SMS.RU.", err)
+		require.True(t, err.IsNil())
+		require.NotNil(t, resp)
+		require.EqualValues(t, expectedStatus, resp.ErrorCode)
+		require.EqualValues(t, PHONE, resp.Recipient)
+		require.EqualValues(t, "RU", resp.Country)
+		require.EqualValues(t, "Свердловская обл.", resp.Region)
+		require.NotEmpty(t, resp.Operator)
+		ekalog.Debug("Message info: %s", spew.Sdump(resp))
+	}
+
+	// The default numbering plan is used if there is no option.
+	smsenderu_numplan.SetDefault(plan)
+	sendResp, err = q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	resp, err := q.Status(context.Background(), sendResp.IDs[0])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, PHONE, resp.Recipient)
+	require.EqualValues(t, "Свердловская обл.", resp.Region)
+
+	// Nil numbering plan disables it.
+	qWithoutPlan := smsenderu_smsru.NewSender(TOKEN,
+		smsenderu_smsru.WithBaseURL(srv.URL()),
+		smsenderu_smsru.WithNumberingPlan(nil),
+	)
+	sendResp, err = qWithoutPlan.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	resp, err = qWithoutPlan.Status(context.Background(), sendResp.IDs[0])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, PHONE, resp.Recipient)
+	require.Empty(t, resp.Country)
+	require.Empty(t, resp.Operator)
+}
+
+func TestSenderSmsRu_StatusNotFound(t *testing.T) {
+	_, q := newTestSender(t)
+	resp, err := q.Status(context.Background(), "202041-1000004")
+	require.True(t, err.IsNil())
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_MESSAGE_NOT_FOUND, resp.ErrorCode)
+	require.True(t, resp.NotFound)
+}
+
+func TestSenderSmsRu_StatusBatch(t *testing.T) {
+	srv, q := newTestSender(t)
+	srv.SetStatusFlow(smsenderu_smsru.STATUS_DELIVERED)
+	srv.SetBalance(decimal.New(1000, 0))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		recipients := make([]string, 50)
+		for j := range recipients {
+			recipients[j] = fmt.Sprintf("7912%07d", i*100+j)
+		}
+		sendResp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+			Recipients: recipients,
+			Message:    "Code: 1234",
+		})
+		require.True(t, err.IsNil())
+		ids = append(ids, sendResp.IDs...)
+	}
+	ids = append(ids, "202041-1000004")
+
+	resp, err := smsenderu.StatusBatch(context.Background(), q, ids)
+	require.True(t, err.IsNil())
+	require.Len(t, resp, len(ids))
+	require.EqualValues(t, 2, srv.Calls("/sms/status"))
+
+	for i, id := range ids[:len(ids)-1] {
+		require.EqualValues(t, id, resp[i].ID)
+		require.False(t, resp[i].NotFound)
+		require.EqualValues(t, smsenderu_smsru.STATUS_DELIVERED, resp[i].ErrorCode)
+		require.EqualValues(t, fmt.Sprintf("7912%07d", i/50*100+i%50), resp[i].Recipient)
+	}
+	require.True(t, resp[len(ids)-1].NotFound)
+}
+
+func TestSenderSmsRu_Conformance(t *testing.T) {
+	newSender := func(t *testing.T, token string) smsenderu.Sender {
+		srv := smsenderu_smsrutest.NewServer(TOKEN)
+		t.Cleanup(srv.Close)
+		return smsenderu_smsru.NewSender(token, smsenderu_smsru.WithBaseURL(srv.URL()))
+	}
+	smsenderu_sendertest.Run(t, smsenderu_sendertest.Config{
+		NewSender: func(t *testing.T) smsenderu.Sender {
+			return newSender(t, TOKEN)
+		},
+		NewSenderWithToken: newSender,
+		NilSender:          smsenderu_smsru.NilSender,
+		Recipients:         []string{PHONE, "79123456780"},
+		StatusOK:           smsenderu_smsru.STATUS_OK,
+	})
+}
+
+func TestSenderSmsRu_ConformanceTextFormat(t *testing.T) {
+	tests := map[string]struct {
+		textOnly bool
+		options  []smsenderu_smsru.Option
+	}{
+		"Requested":  {options: []smsenderu_smsru.Option{smsenderu_smsru.WithTextFormat()}},
+		"IgnoreJSON": {textOnly: true},
+	}
+	for name, test := range tests {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			newSender := func(t *testing.T, token string) smsenderu.Sender {
+				srv := smsenderu_smsrutest.NewServer(TOKEN)
+				srv.SetTextOnly(test.textOnly)
+				t.Cleanup(srv.Close)
+				options := append([]smsenderu_smsru.Option{smsenderu_smsru.WithBaseURL(srv.URL())}, test.options...)
+				return smsenderu_smsru.NewSender(token, options...)
+			}
+			smsenderu_sendertest.Run(t, smsenderu_sendertest.Config{
+				NewSender: func(t *testing.T) smsenderu.Sender {
+					return newSender(t, TOKEN)
+				},
+				NewSenderWithToken: newSender,
+				NilSender:          smsenderu_smsru.NilSender,
+				Recipients:         []string{PHONE, "79123456780"},
+				StatusOK:           smsenderu_smsru.STATUS_OK,
+			})
+		})
+	}
+}
+
+func TestSenderSmsRu_JSON(t *testing.T) {
+	srv, q := newTestSender(t)
+	srv.SetPhoneError("79123456780", smsenderu_smsru.ERROR_CODE_SPAM_DETECTED)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, "79123456780"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_SPAM_DETECTED, resp.ErrorCodes[1])
+	require.EqualValues(t, "1", srv.Messages()[0].Args["json"])
+
+	status, err := q.Status(context.Background(), resp.IDs[0])
+	require.True(t, err.IsNil())
+	require.EqualValues(t, smsenderu_smsru.STATUS_PENDING_BY_OPERATOR, status.ErrorCode)
+	require.EqualValues(t, smsenderu_smsru.StatusText(smsenderu_smsru.STATUS_PENDING_BY_OPERATOR), status.StatusText)
+	require.NotEmpty(t, status.StatusText)
+
+	status, err = q.Status(context.Background(), "202041-1000004")
+	require.True(t, err.IsNil())
+	require.True(t, status.NotFound)
+	require.NotEmpty(t, status.StatusText)
+
+	srv.SetMethodError("/my/balance", smsenderu_smsru.ERROR_CODE_EXPIRED_API_TOKEN)
+	_, _, err = q.Balance(context.Background())
+	require.True(t, err.IsNotNil())
+}
+
+func TestSenderSmsRu_Open(t *testing.T) {
+	srv, _ := newTestSender(t)
+	srv.SetSenders("MyShop")
+
+	q, err := smsenderu.Open("smsru://" + TOKEN + "?timeout=5s&from=MyShop&max_redirects=2&base_url=" +
+		url.QueryEscape(srv.URL()))
+	require.True(t, err.IsNil())
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "MyShop", srv.MessagesTo(PHONE)[0].From)
+
+	_, err = smsenderu.Open("smsru://" + TOKEN + "?unknown=1")
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+}
+
+func TestSenderSmsRu_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	q := smsenderu_smsru.NewSender(TOKEN)
+	err := q.Check(ctx)
+	require.True(t, err.IsNotNil())
+	require.True(t, err.Is(smsenderu.Canceled))
+}
+
+func TestSenderSmsRu_DeadlineExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), -1*time.Second)
+	defer cancel()
 	q := smsenderu_smsru.NewSender(TOKEN)
-	resp, err := q.Status(sentSmsId)
-	ekalog.Errore("Failed to get an info about sent message using SMS.RU.", err)
+	_, _, err := q.Balance(ctx)
+	require.True(t, err.IsNotNil())
+	require.True(t, err.Is(smsenderu.DeadlineExceeded))
+}
+
+func TestSenderSmsRu_WithTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		_, _ = w.Write([]byte("100\n"))
+	}))
+	defer srv.Close()
+	q := smsenderu_smsru.NewSender(TOKEN,
+		smsenderu_smsru.WithBaseURL(srv.URL),
+		smsenderu_smsru.WithTimeout(50*time.Millisecond),
+	)
+	err := q.Check(context.Background())
+	require.True(t, err.IsNotNil())
+	require.True(t, err.Is(smsenderu.DeadlineExceeded))
+}
+
+func TestSenderSmsRu_NetHTTPTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.EqualValues(t, "/my/balance", r.URL.Path)
+		require.EqualValues(t, TOKEN, r.URL.Query().Get("api_id"))
+		_, _ = w.Write([]byte("100\n10.5"))
+	}))
+	defer srv.Close()
+	q := smsenderu_smsru.NewSender(TOKEN,
+		smsenderu_smsru.WithBaseURL(srv.URL),
+		smsenderu_smsru.WithTransport(smsenderu.NewNetHTTPTransport(srv.Client())),
+	)
+	balance, currency, err := q.Balance(context.Background())
 	require.True(t, err.IsNil())
-	require.NotNil(t, resp)
-	ekalog.Debug("Message info: %s", spew.Sdump(resp))
+	require.EqualValues(t, "RUB", currency)
+	require.EqualValues(t, "10.5", balance.String())
+}
+
+func TestSenderSmsRu_TransportErrorNoSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	baseURL := srv.URL
+	srv.Close()
+
+	transports := map[string]smsenderu.Transport{
+		"NetHTTP":  smsenderu.NewNetHTTPTransport(nil),
+		"FastHTTP": smsenderu.NewFastHTTPTransport(nil, 0),
+	}
+	b := bytes.NewBuffer(nil)
+	ekalog.ReplaceIntegrator(new(ekalog.CommonIntegrator).
+		WithEncoder(new(ekalog.CI_JSONEncoder)).
+		WriteTo(b))
+
+	for name, transport := range transports {
+		q := smsenderu_smsru.NewSender(TOKEN,
+			smsenderu_smsru.WithBaseURL(baseURL),
+			smsenderu_smsru.WithTransport(transport),
+		)
+		_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+			Recipient: PHONE,
+			Message:   "Code: 98765",
+		})
+		require.True(t, err.IsNotNil(), name)
+
+		b.Reset()
+		ekalog.Errore("", err)
+		dump := b.String()
+		require.Contains(t, dump, baseURL+"/sms/send", name)
+		require.NotContains(t, dump, TOKEN, name)
+		require.NotContains(t, dump, "98765", name)
+	}
+}
+
+func newTestSenderWithRetry(t *testing.T, policy smsenderu_smsru.RetryPolicy) (*smsenderu_smsrutest.Server, smsenderu.Sender) {
+	srv := smsenderu_smsrutest.NewServer(TOKEN)
+	t.Cleanup(srv.Close)
+	return srv, smsenderu_smsru.NewSender(TOKEN,
+		smsenderu_smsru.WithBaseURL(srv.URL()),
+		smsenderu_smsru.WithRetry(policy),
+	)
+}
+
+func TestSenderSmsRu_RetrySafe(t *testing.T) {
+	srv, q := newTestSenderWithRetry(t, smsenderu_smsru.RetryPolicy{MaxAttempts: 3})
+	srv.FailNext("/sms/send", smsenderu_smsru.ERROR_CODE_TEMPORARY_UNAVAILABLE, 2)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.NotEmpty(t, resp.IDs[0])
+	require.EqualValues(t, 3, srv.Calls("/sms/send"))
+	require.Len(t, srv.Messages(), 1)
+}
+
+func TestSenderSmsRu_RetryExhausted(t *testing.T) {
+	srv, q := newTestSenderWithRetry(t, smsenderu_smsru.RetryPolicy{MaxAttempts: 2})
+	srv.FailNext("/my/balance", smsenderu_smsru.ERROR_CODE_INTERNAL_SERVER_ERROR, 2)
+
+	_, _, err := q.Balance(context.Background())
+	require.True(t, err.Is(smsenderu.ProviderUnavailable))
+	require.EqualValues(t, 2, srv.Calls("/my/balance"))
+}
+
+func TestSenderSmsRu_RetryAmbiguousSend(t *testing.T) {
+	srv, q := newTestSenderWithRetry(t, smsenderu_smsru.RetryPolicy{MaxAttempts: 3})
+	srv.FailNext("/sms/send", smsenderu_smsru.ERROR_CODE_INTERNAL_SERVER_ERROR, 1)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   "Code: 1234",
+	}
+
+	_, err := q.Send(context.Background(), req)
+	require.True(t, err.Is(smsenderu.ProviderUnavailable))
+	require.EqualValues(t, 1, srv.Calls("/sms/send"))
+
+	srv, q = newTestSenderWithRetry(t, smsenderu_smsru.RetryPolicy{MaxAttempts: 3, RetryAmbiguousSend: true})
+	srv.FailNext("/sms/send", smsenderu_smsru.ERROR_CODE_INTERNAL_SERVER_ERROR, 1)
+
+	_, err = q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, 2, srv.Calls("/sms/send"))
+}
+
+func TestSenderSmsRu_SendTooLong(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   strings.Repeat("ы", 67*smsenderu_smsru.MAX_MESSAGE_SEGMENTS+1),
+	})
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.EqualValues(t, 0, srv.Calls("/sms/send"))
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		Message:   strings.Repeat("ы", 67*smsenderu_smsru.MAX_MESSAGE_SEGMENTS),
+	})
+	require.True(t, err.IsNil())
+}
+
+func TestSenderSmsRu_Validate(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, ""},
+		Message:    "Code: 1234",
+		SendAt:     ekatime.NewTimestampNow() + 31*ekatime.SECONDS_IN_DAY,
+		TTL:        25 * time.Hour,
+	}
+
+	errs := smsenderu_smsru.Validate(req)
+	require.Len(t, errs, 3, errs.String())
+	require.True(t, errs.Has("Recipients[1]", smsenderu.FIELD_RULE_REQUIRED))
+	require.True(t, errs.Has("SendAt", smsenderu.FIELD_RULE_RANGE))
+	require.True(t, errs.Has("TTL", smsenderu.FIELD_RULE_RANGE))
+
+	_, err := q.Send(context.Background(), req)
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	_, err = q.Cost(context.Background(), req)
+	require.True(t, err.Is(ekaerr.IllegalArgument))
+	require.EqualValues(t, 0, srv.Calls("/sms/send"))
+
+	// The recipients limit is a rule of one call of sms.ru API only.
+	recipients := make([]string, smsenderu_smsru.MAX_RECIPIENTS+1)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("7912%07d", i)
+	}
+	req = &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Message:    "Code: 1234",
+	}
+	require.Nil(t, smsenderu_smsru.Validate(req), "Zero TTL must be allowed")
+	errs = smsenderu_smsru.Validate(req, smsenderu.MaxRecipients(smsenderu_smsru.MAX_RECIPIENTS))
+	require.True(t, errs.Has("Recipients", smsenderu.FIELD_RULE_MAX))
+}
+
+func TestSenderSmsRu_HLRUnsupported(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	_, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		IsHLR:     true,
+	})
+	require.True(t, err.Is(ekaerr.UnsupportedOperation))
+
+	_, err = q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		IsPing:    true,
+	})
+	require.True(t, err.Is(ekaerr.UnsupportedOperation))
+
+	_, err = q.Cost(context.Background(), &smsenderu.SendMessageRequest{
+		Recipient: PHONE,
+		IsHLR:     true,
+	})
+	require.True(t, err.Is(ekaerr.UnsupportedOperation))
+
+	require.EqualValues(t, 0, srv.Calls("/sms/send"))
+	require.EqualValues(t, 0, srv.Calls("/sms/cost"))
+}
+
+func TestSenderSmsRu_SendPersonalized(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	req := &smsenderu.SendMessageRequest{
+		Recipients: []string{"79123456780", "+7 (912) 345-67-89", "123", "79120000000"},
+		Messages:   []string{"Hello, Ann", "Hello, Bob", "Hello, Nobody", "Hello, Eve"},
+	}
+	resp, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 4)
+	require.EqualValues(t, 1, srv.Calls("/sms/send"))
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[2])
+	require.Empty(t, resp.IDs[2])
+
+	expected := map[int]string{0: "79123456780", 1: "79123456789", 3: "79120000000"}
+	for i, recipient := range expected {
+		require.EqualValues(t, smsenderu_smsru.STATUS_OK, resp.ErrorCodes[i])
+		status, err := q.Status(context.Background(), resp.IDs[i])
+		require.True(t, err.IsNil())
+		require.EqualValues(t, recipient, status.Recipient)
+	}
+
+	for _, message := range srv.Messages() {
+		switch message.Recipient {
+		case "79123456780":
+			require.EqualValues(t, "Hello, Ann", message.Text)
+		case "79123456789":
+			require.EqualValues(t, "Hello, Bob", message.Text)
+		case "79120000000":
+			require.EqualValues(t, "Hello, Eve", message.Text)
+		}
+	}
+
+	cost, err := q.Cost(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79123456780", "79123456789"},
+		Messages:   []string{"Hello", strings.Repeat("a", 161)},
+	})
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "4.5", cost.Total.String())
+}
+
+func TestSenderSmsRu_SendPersonalizedSamePhone(t *testing.T) {
+	srv, q := newTestSender(t)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{PHONE, PHONE},
+		Messages:   []string{"Your code: 1234", "Your password: qwerty"},
+	})
+	require.True(t, err.IsNil())
+	require.Len(t, resp.IDs, 2)
+	require.NotEmpty(t, resp.IDs[0])
+	require.NotEmpty(t, resp.IDs[1])
+	require.EqualValues(t, 2, srv.Calls("/sms/send"))
+	require.Len(t, srv.Messages(), 2)
+}
+
+func TestSenderSmsRu_SendChunked(t *testing.T) {
+	srv, q := newTestSender(t)
+	srv.SetBalance(decimal.New(1000, 0))
+
+	recipients := make([]string, 250)
+	for i := range recipients {
+		recipients[i] = fmt.Sprintf("7912%07d", i)
+	}
+	recipients[42] = "123"
+
+	// One of the chunks fails, the others must be kept.
+	srv.FailNext("/sms/send", smsenderu_smsru.ERROR_CODE_TEMPORARY_UNAVAILABLE, 1)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.Is(smsenderu.PartialFailure))
+	require.Len(t, resp.IDs, len(recipients))
+	require.EqualValues(t, 3, srv.Calls("/sms/send"))
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.ErrorCodes[42])
+	require.EqualValues(t, smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER, resp.Results[42].ErrorCode)
+	require.True(t, resp.Balance.Equal(srv.Balance()), "Balance must be the one after the last chunk")
+
+	// Invalid recipient is dropped before the request is split,
+	// so the chunks are made of valid ones: 100, 100, 49.
+	var failed []int
+	for i := range recipients {
+		if i == 42 {
+			continue
+		}
+		validIdx := i
+		if i > 42 {
+			validIdx--
+		}
+		if resp.IDs[i] == "" {
+			failed = append(failed, validIdx)
+			require.EqualValues(t, smsenderu.ERROR_CODE_NOT_SENT, resp.ErrorCodes[i])
+			require.EqualValues(t, recipients[i], resp.Results[i].Phone)
+			require.True(t, resp.Results[i].Err.Is(smsenderu.ProviderUnavailable))
+		}
+	}
+	require.Contains(t, []int{100, 49}, len(failed))
+	require.EqualValues(t, failed[0]/smsenderu_smsru.MAX_RECIPIENTS, failed[len(failed)-1]/smsenderu_smsru.MAX_RECIPIENTS)
+	require.Len(t, srv.Messages(), len(recipients)-1-len(failed))
+
+	for _, message := range srv.Messages() {
+		require.NotEqual(t, "123", message.Recipient)
+	}
+	for i := range recipients {
+		if resp.IDs[i] != "" {
+			status, err := q.Status(context.Background(), resp.IDs[i])
+			require.True(t, err.IsNil())
+			require.EqualValues(t, recipients[i], status.Recipient)
+		}
+	}
+
+	recipients[42] = "79990000000"
+	cost, err := q.Cost(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: recipients,
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "375", cost.Total.String())
+	require.EqualValues(t, 3, srv.Calls("/sms/cost"))
 }
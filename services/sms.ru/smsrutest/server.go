@@ -0,0 +1,539 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_smsrutest provides an in-process fake of the sms.ru API
+// that speaks the same protocol as the real one and allows to run
+// sms.ru Sender's tests offline.
+package smsenderu_smsrutest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/smsenderu/segment"
+	"github.com/qioalice/smsenderu/services/sms.ru"
+)
+
+type (
+	// Server is a fake of sms.ru API. It's safe for concurrent use.
+	//
+	// All scriptable parameters (balance, senders, error codes, statuses)
+	// might be changed at any time, even when requests are in progress.
+	// Use URL() as a base URL of sms.ru Sender (smsenderu_smsru.WithBaseURL()).
+	Server struct {
+		srv   *httptest.Server
+		token string
+
+		mu            sync.Mutex
+		balance       decimal.Decimal
+		costPerSms    decimal.Decimal
+		senders       []string
+		phoneErrors   map[string]int
+		methodErrors  map[string]int
+		failNext      map[string][]int
+		calls         map[string]int
+		statusFlow    []int
+		phoneStatuses map[string][]int
+		messages      []*Message
+		messagesByID  map[string]*Message
+		nextID        int
+		textOnly      bool
+	}
+
+	// reply is the response of API method in both formats.
+	reply struct {
+		lines []string
+		json  map[string]interface{}
+	}
+
+	// Message is a message that has been sent using Server.
+	Message struct {
+		ID        string
+		Recipient string
+		Text      string
+		From      string
+		Args      map[string]string
+
+		// statusIdx is an index of the current status in the status flow
+		// which is used for this message.
+		statusIdx  int
+		statusFlow []int
+	}
+)
+
+// NewServer starts and returns a new fake sms.ru API server,
+// which accepts only provided API token.
+//
+// By default, balance is 100.00 RUB, one sms costs 1.50 RUB, there is no senders,
+// and each message goes through STATUS_PENDING_BY_OPERATOR, STATUS_PENDING
+// to STATUS_DELIVERED, one status per each Status() call.
+//
+// Call Close() when it's no longer needed.
+func NewServer(token string) *Server {
+
+	q := &Server{
+		token:         token,
+		balance:       decimal.New(10000, -2),
+		costPerSms:    decimal.New(150, -2),
+		phoneErrors:   make(map[string]int),
+		methodErrors:  make(map[string]int),
+		failNext:      make(map[string][]int),
+		calls:         make(map[string]int),
+		phoneStatuses: make(map[string][]int),
+		messagesByID:  make(map[string]*Message),
+		statusFlow: []int{
+			smsenderu_smsru.STATUS_PENDING_BY_OPERATOR,
+			smsenderu_smsru.STATUS_PENDING,
+			smsenderu_smsru.STATUS_DELIVERED,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/check", q.handle(q.authCheck))
+	mux.HandleFunc("/my/balance", q.handle(q.myBalance))
+	mux.HandleFunc("/my/senders", q.handle(q.mySenders))
+	mux.HandleFunc("/sms/send", q.handle(q.smsSend))
+	mux.HandleFunc("/sms/cost", q.handle(q.smsCost))
+	mux.HandleFunc("/sms/status", q.handle(q.smsStatus))
+
+	q.srv = httptest.NewServer(mux)
+	return q
+}
+
+// URL returns a base URL of Server, like "http://127.0.0.1:port".
+func (q *Server) URL() string {
+	return q.srv.URL
+}
+
+// Close shuts down the Server and blocks until all requests are done.
+func (q *Server) Close() {
+	q.srv.Close()
+}
+
+// SetBalance sets the current account's balance (in RUB).
+func (q *Server) SetBalance(balance decimal.Decimal) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.balance = balance
+}
+
+// Balance returns the current account's balance (in RUB).
+func (q *Server) Balance() decimal.Decimal {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.balance
+}
+
+// SetCostPerSms sets the cost of one sms (one segment of message) in RUB.
+func (q *Server) SetCostPerSms(cost decimal.Decimal) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.costPerSms = cost
+}
+
+// SetSenders sets the list of approved senders.
+func (q *Server) SetSenders(senders ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.senders = append([]string(nil), senders...)
+}
+
+// SetPhoneError makes Server to reject sending messages to the provided phone
+// number with provided sms.ru error code (e.g. ERROR_CODE_BAD_PHONE_NUMBER).
+// Zero code removes the rule.
+func (q *Server) SetPhoneError(phone string, code int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if code == 0 {
+		delete(q.phoneErrors, phone)
+	} else {
+		q.phoneErrors[phone] = code
+	}
+}
+
+// SetMethodError makes Server to respond to the whole API method's request
+// (e.g. "/sms/send") with provided sms.ru error code
+// (e.g. ERROR_CODE_TEMPORARY_UNAVAILABLE). Zero code removes the rule.
+func (q *Server) SetMethodError(path string, code int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if code == 0 {
+		delete(q.methodErrors, path)
+	} else {
+		q.methodErrors[path] = code
+	}
+}
+
+// FailNext makes Server to respond to the next n requests of API method
+// (e.g. "/sms/send") with provided sms.ru error code
+// (e.g. ERROR_CODE_TEMPORARY_UNAVAILABLE). The method works normally after that.
+func (q *Server) FailNext(path string, code, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := 0; i < n; i++ {
+		q.failNext[path] = append(q.failNext[path], code)
+	}
+}
+
+// Calls returns the number of requests of API method (e.g. "/sms/send")
+// Server has received.
+func (q *Server) Calls(path string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.calls[path]
+}
+
+// SetStatusFlow sets the sequence of delivery statuses the message goes through.
+// Each Status() call advances message to the next status until the last one.
+// It affects only messages that will be sent after this call.
+func (q *Server) SetStatusFlow(statuses ...int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(statuses) > 0 {
+		q.statusFlow = append([]int(nil), statuses...)
+	}
+}
+
+// SetPhoneStatusFlow is the same as SetStatusFlow() but only for messages
+// that are sent to the provided phone number. Empty statuses removes the rule.
+func (q *Server) SetPhoneStatusFlow(phone string, statuses ...int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(statuses) == 0 {
+		delete(q.phoneStatuses, phone)
+	} else {
+		q.phoneStatuses[phone] = append([]int(nil), statuses...)
+	}
+}
+
+// SetTextOnly makes Server to respond in the legacy text format
+// even if JSON is requested ("json=1"), like the old sms.ru API gateways do.
+func (q *Server) SetTextOnly(textOnly bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.textOnly = textOnly
+}
+
+// Messages returns all messages that have been sent using Server,
+// in the order they have been sent.
+func (q *Server) Messages() []Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	messages := make([]Message, len(q.messages))
+	for i, message := range q.messages {
+		messages[i] = *message
+	}
+	return messages
+}
+
+// MessagesTo returns all messages that have been sent to the provided
+// phone number, in the order they have been sent.
+func (q *Server) MessagesTo(phone string) []Message {
+	var messages []Message
+	for _, message := range q.Messages() {
+		if message.Recipient == phone {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// handle returns an HTTP handler that checks API token and method's errors
+// before calling the handler of API method, and writes the reply
+// the handler returns in the requested format (JSON if "json=1", text otherwise).
+func (q *Server) handle(cb func(r *http.Request) *reply) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var resp *reply
+
+		q.mu.Lock()
+		q.calls[r.URL.Path]++
+		code, hasMethodErr := q.methodErrors[r.URL.Path]
+		if failNext := q.failNext[r.URL.Path]; len(failNext) > 0 {
+			code, hasMethodErr = failNext[0], true
+			q.failNext[r.URL.Path] = failNext[1:]
+		}
+		textOnly := q.textOnly
+		q.mu.Unlock()
+
+		switch {
+		case r.Form.Get("api_id") != q.token:
+			resp = errorReply(smsenderu_smsru.ERROR_CODE_INCORRECT_API_TOKEN)
+		case hasMethodErr:
+			resp = errorReply(code)
+		default:
+			resp = cb(r)
+		}
+
+		if r.Form.Get("json") == "1" && !textOnly {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp.json)
+			return
+		}
+
+		_, _ = w.Write([]byte(strings.Join(resp.lines, "\n")))
+	}
+}
+
+func (q *Server) authCheck(_ *http.Request) *reply {
+	return okReply(nil)
+}
+
+func (q *Server) myBalance(_ *http.Request) *reply {
+	balance := q.Balance()
+	resp := okReply(map[string]interface{}{"balance": json.Number(balance.StringFixed(2))})
+	resp.lines = append(resp.lines, balance.StringFixed(2))
+	return resp
+}
+
+func (q *Server) mySenders(_ *http.Request) *reply {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	resp := okReply(map[string]interface{}{"senders": append([]string{}, q.senders...)})
+	resp.lines = append(resp.lines, q.senders...)
+	return resp
+}
+
+func (q *Server) smsSend(r *http.Request) *reply {
+
+	recipients, texts := q.parseMessage(r)
+	if code := q.validateMessage(r, recipients, texts); code != 0 {
+		return errorReply(code)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	costs, total := q.costsOf(texts)
+	if q.balance.LessThan(total) {
+		return errorReply(smsenderu_smsru.ERROR_CODE_NOT_ENOUGH_MONEY)
+	}
+
+	results := make(map[string]interface{}, len(recipients))
+	resp := okReply(map[string]interface{}{"sms": results})
+
+	for i, recipient := range recipients {
+
+		if code, ok := q.phoneErrors[recipient]; ok {
+			results[recipient] = statusOf(code)
+			resp.lines = append(resp.lines, strconv.Itoa(code))
+			continue
+		}
+
+		q.nextID++
+		message := &Message{
+			ID:         fmt.Sprintf("000000-%07d", q.nextID),
+			Recipient:  recipient,
+			Text:       texts[i],
+			From:       r.Form.Get("from"),
+			Args:       make(map[string]string, len(r.Form)),
+			statusFlow: q.statusFlow,
+		}
+		if statusFlow, ok := q.phoneStatuses[recipient]; ok {
+			message.statusFlow = statusFlow
+		}
+		for key := range r.Form {
+			message.Args[key] = r.Form.Get(key)
+		}
+
+		q.messages = append(q.messages, message)
+		q.messagesByID[message.ID] = message
+		q.balance = q.balance.Sub(costs[i])
+
+		result := statusOf(smsenderu_smsru.STATUS_OK)
+		result["sms_id"] = message.ID
+		result["cost"] = costs[i].StringFixed(2)
+		result["sms"] = smsenderu_segment.Segments(texts[i])
+		results[recipient] = result
+		resp.lines = append(resp.lines, message.ID)
+	}
+
+	resp.json["balance"] = json.Number(q.balance.StringFixed(2))
+	resp.lines = append(resp.lines, "balance="+q.balance.StringFixed(2))
+	return resp
+}
+
+func (q *Server) smsCost(r *http.Request) *reply {
+
+	recipients, texts := q.parseMessage(r)
+	if code := q.validateMessage(r, recipients, texts); code != 0 {
+		return errorReply(code)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	costs, total := q.costsOf(texts)
+	results := make(map[string]interface{}, len(recipients))
+
+	n := 0
+	for i, recipient := range recipients {
+		segments := smsenderu_segment.Segments(texts[i])
+		result := statusOf(smsenderu_smsru.STATUS_OK)
+		result["cost"] = costs[i].StringFixed(2)
+		result["sms"] = segments
+		results[recipient] = result
+		n += segments
+	}
+
+	resp := okReply(map[string]interface{}{
+		"sms":        results,
+		"total_cost": json.Number(total.StringFixed(2)),
+		"total_sms":  n,
+	})
+	resp.lines = append(resp.lines, total.StringFixed(2), strconv.Itoa(n))
+	return resp
+}
+
+func (q *Server) smsStatus(r *http.Request) *reply {
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := strings.Split(r.Form.Get("sms_id"), ",")
+	results := make(map[string]interface{}, len(ids))
+	resp := okReply(map[string]interface{}{"sms": results})
+
+	for _, id := range ids {
+		message, ok := q.messagesByID[id]
+		if !ok {
+			results[id] = statusOf(smsenderu_smsru.ERROR_CODE_MESSAGE_NOT_FOUND)
+			resp.lines = append(resp.lines, strconv.Itoa(smsenderu_smsru.ERROR_CODE_MESSAGE_NOT_FOUND))
+			continue
+		}
+
+		status := message.statusFlow[message.statusIdx]
+		if message.statusIdx < len(message.statusFlow)-1 {
+			message.statusIdx++
+		}
+
+		results[id] = statusOf(status)
+		resp.lines = append(resp.lines, strconv.Itoa(status))
+	}
+
+	return resp
+}
+
+// okReply returns a successful reply with provided JSON fields.
+// Text lines must be appended by the caller.
+func okReply(fields map[string]interface{}) *reply {
+	resp := &reply{
+		lines: []string{strconv.Itoa(smsenderu_smsru.STATUS_OK)},
+		json:  statusOf(smsenderu_smsru.STATUS_OK),
+	}
+	for key, value := range fields {
+		resp.json[key] = value
+	}
+	return resp
+}
+
+// errorReply returns a reply of failed request with provided sms.ru error code.
+func errorReply(code int) *reply {
+	return &reply{
+		lines: []string{strconv.Itoa(code)},
+		json:  statusOf(code),
+	}
+}
+
+// statusOf returns JSON fields of sms.ru status (of response or message).
+func statusOf(code int) map[string]interface{} {
+	status := "OK"
+	if code != smsenderu_smsru.STATUS_OK && (code < smsenderu_smsru.STATUS_PENDING_BY_OPERATOR ||
+		code > smsenderu_smsru.STATUS_NOT_DELIVERED_BAD_ROUTE) {
+		status = "ERROR"
+	}
+	return map[string]interface{}{
+		"status":      status,
+		"status_code": code,
+		"status_text": smsenderu_smsru.StatusText(code),
+	}
+}
+
+// parseMessage returns the recipients and the texts of their messages
+// from the request. Personalized messages (multi[phone]=text) are returned
+// in the order of their keys, the one the sms.ru Sender encodes them in.
+func (q *Server) parseMessage(r *http.Request) (recipients, texts []string) {
+
+	var keys []string
+	for key := range r.Form {
+		if strings.HasPrefix(key, "multi[") && strings.HasSuffix(key, "]") {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		for _, key := range keys {
+			recipients = append(recipients, key[len("multi["):len(key)-1])
+			texts = append(texts, r.Form.Get(key))
+		}
+		return recipients, texts
+	}
+
+	for _, recipient := range strings.Split(r.Form.Get("to"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+			texts = append(texts, r.Form.Get("msg"))
+		}
+	}
+	return recipients, texts
+}
+
+// costsOf returns the cost of each message and their total cost.
+// Server must be locked.
+func (q *Server) costsOf(texts []string) (costs []decimal.Decimal, total decimal.Decimal) {
+	costs = make([]decimal.Decimal, len(texts))
+	for i, text := range texts {
+		costs[i] = q.costPerSms.Mul(decimal.NewFromInt(int64(smsenderu_segment.Segments(text))))
+		total = total.Add(costs[i])
+	}
+	return costs, total
+}
+
+// validateMessage returns an sms.ru error code if the request of sending message
+// is invalid or 0 otherwise.
+func (q *Server) validateMessage(r *http.Request, recipients, texts []string) int {
+	switch {
+	case len(recipients) == 0:
+		return smsenderu_smsru.ERROR_CODE_BAD_PHONE_NUMBER
+	case len(recipients) > 100:
+		return smsenderu_smsru.ERROR_CODE_TOO_MUCH_PHONE_NUMBERS
+	}
+	for _, text := range texts {
+		switch {
+		case text == "":
+			return smsenderu_smsru.ERROR_CODE_NO_MESSAGE_BODY
+		case !utf8.ValidString(text):
+			return smsenderu_smsru.ERROR_CODE_INCORRECT_MESSAGE_BODY_ENCODING
+		case smsenderu_segment.Segments(text) > smsenderu_smsru.MAX_MESSAGE_SEGMENTS:
+			return smsenderu_smsru.ERROR_CODE_MESSAGE_BODY_TOO_LARGE
+		}
+	}
+	if from := r.Form.Get("from"); from != "" {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		for _, sender := range q.senders {
+			if sender == from {
+				return 0
+			}
+		}
+		return smsenderu_smsru.ERROR_CODE_SENDER_IS_NOT_APPROVED
+	}
+	return 0
+}
@@ -6,54 +6,78 @@
 package smsenderu_smsru
 
 import (
-	"time"
+	"strconv"
 
 	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/phone"
 
+	"github.com/qioalice/ekago/v3/ekaerr"
 	"github.com/qioalice/ekago/v3/ekatime"
 )
 
-func sendMessageRequestIsValid(req *smsenderu.SendMessageRequest) bool {
-
-	isValid := req != nil &&
-		(req.Recipient != "" ||
-			(len(req.Recipients) > 0 && req.Recipients[0] != "")) &&
-		req.Message != ""
-
-	if !isValid {
-		return false
+// normalizedRequest returns a copy of valid SendMessageRequest
+// the message is sent by, so the caller's request is never changed
+// and may be shared between goroutines.
+// SendAt in the past is reset, the message is sent immediately then.
+func normalizedRequest(req *smsenderu.SendMessageRequest) *smsenderu.SendMessageRequest {
+	reqCopy := *req
+	if reqCopy.SendAt != 0 && reqCopy.SendAt <= ekatime.OnceInMinute.Now() {
+		reqCopy.SendAt = 0
 	}
+	return &reqCopy
+}
 
-	if req.SendAt != 0 {
-		if req.SendAt > ekatime.OnceInMinute.Now()+ekatime.SECONDS_IN_DAY*30 {
-			return false
-		}
-		if req.SendAt <= ekatime.OnceInMinute.Now() {
-			req.SendAt = 0
+// indexOf returns the index of the first s in ss or -1.
+func indexOf(ss []string, s string) int {
+	for i := range ss {
+		if ss[i] == s {
+			return i
 		}
 	}
+	return -1
+}
+
+// parseRecipients returns the recipients of SendMessageRequest normalized
+// to E.164 (without plus sign, as sms.ru wants) and the error classes
+// of the recipients that are not valid phone numbers by their indexes.
+// Invalid recipients are kept as is.
+func parseRecipients(req *smsenderu.SendMessageRequest) (recipients []string, invalid map[int]ekaerr.Class) {
 
-	if req.TTL < 1*time.Minute || req.TTL > 24*time.Hour {
-		return false
+	recipients = append([]string(nil), req.AllRecipients()...)
+
+	for i, recipient := range recipients {
+		n, err := smsenderu_phone.Parse(recipient)
+		if err.IsNotNil() {
+			if invalid == nil {
+				invalid = make(map[int]ekaerr.Class)
+			}
+			invalid[i] = err.Class()
+			continue
+		}
+		recipients[i] = n.Digits()
 	}
 
-	return true
+	return recipients, invalid
 }
 
-func sendMessageRequestWhyInvalid(req *smsenderu.SendMessageRequest) string {
-	switch {
-	case req == nil:
-		return "Request object is nil"
-	case req.Recipient == "" && (len(req.Recipients) == 0 || req.Recipients[0] == ""):
-		return "No recipient is specified"
-	case req.Message == "":
-		return "No message body is specified"
-	case req.SendAt != 0 && req.SendAt > ekatime.OnceInMinute.Now()+
-		ekatime.SECONDS_IN_DAY*30:
-		return "SendAt is more than 2 month over today"
-	case req.TTL < 1*time.Minute || req.TTL > 24*time.Hour:
-		return "TTL is in incorrect range, only [1m..24h] is allowed"
-	default:
-		return "Internal error. sendMessageRequestWhyInvalid()."
+// invalidRecipientsError returns an error that contains an info
+// about each invalid recipient: its index, the hash of value
+// (see smsenderu_phone.Hash()) and the reason.
+func invalidRecipientsError(message string, recipients []string, invalid map[int]ekaerr.Class) *ekaerr.Error {
+
+	err := ekaerr.IllegalArgument.New(message).
+		WithString("description", "Recipient(s) are not valid phone numbers.").
+		WithInt("smsru_invalid_recipients", len(invalid))
+
+	for i := range recipients {
+		if cls, isInvalid := invalid[i]; isInvalid {
+			key := "smsru_invalid_recipient_" + strconv.Itoa(i)
+			err = err.
+				WithString(key+"_hash", smsenderu_phone.Hash(recipients[i])).
+				WithString(key+"_reason", cls.Name())
+		}
 	}
+
+	return err.
+		Throw()
 }
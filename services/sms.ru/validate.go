@@ -0,0 +1,38 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_smsru
+
+import (
+	"time"
+
+	"github.com/qioalice/smsenderu"
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// MAX_SEND_AT_DELAY is how far the sending may be deferred to (SendAt).
+	MAX_SEND_AT_DELAY = 30 * 24 * time.Hour
+
+	// MIN_TTL, MAX_TTL are the range of TTL sms.ru accepts.
+	MIN_TTL = 1 * time.Minute
+	MAX_TTL = 24 * time.Hour
+)
+
+// Validate checks SendMessageRequest by the common rules (see smsenderu.Validate())
+// and sms.ru's ones: SendAt is not more than MAX_SEND_AT_DELAY from now,
+// TTL (if specified) is in the range [MIN_TTL..MAX_TTL].
+// It's what Send() and Cost() reject the request by.
+//
+// The number of recipients is not limited, since Send() and Cost() split
+// larger requests into chunks of MAX_RECIPIENTS. Pass
+// smsenderu.MaxRecipients(MAX_RECIPIENTS) to check that the request
+// is sent by one call of sms.ru API.
+func Validate(req *smsenderu.SendMessageRequest, rules ...smsenderu.ValidationRule) smsenderu.ValidationErrors {
+	return smsenderu.Validate(req, append([]smsenderu.ValidationRule{
+		smsenderu.SendAtWithin(MAX_SEND_AT_DELAY),
+		smsenderu.TTLWithin(MIN_TTL, MAX_TTL),
+	}, rules...)...)
+}
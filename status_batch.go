@@ -0,0 +1,136 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// StatusBatcher is an optional interface of Sender, that is able
+	// to get an info about many messages at once.
+	// Use StatusBatch() instead of calling it directly.
+	//
+	// StatusBatch must return the responses in the same order as sentSmsIds,
+	// one per ID. Messages that are not found must be marked
+	// (StatusMessageResponse.NotFound) instead of failing the whole batch.
+	StatusBatcher interface {
+		StatusBatch(ctx context.Context, sentSmsIds []string) ([]*StatusMessageResponse, *ekaerr.Error)
+	}
+)
+
+// StatusBatch returns an info about many messages, one response per ID
+// in the same order as sentSmsIds. Messages that are not found are marked
+// by StatusMessageResponse.NotFound.
+//
+// If sender implements StatusBatcher, it's used (and it splits IDs into
+// the chunks provider allows). Otherwise, Status() is called for each ID.
+func StatusBatch(
+
+	ctx context.Context,
+	sender Sender,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to get an info about messages."
+
+	if sender == nil {
+		return nil, ekaerr.IllegalArgument.New(s).
+			WithString("description", "Sender is nil.").
+			Throw()
+	}
+
+	if len(sentSmsIds) == 0 {
+		return nil, nil
+	}
+
+	if batcher, ok := sender.(StatusBatcher); ok {
+		return batcher.StatusBatch(ctx, sentSmsIds)
+	}
+
+	if resp, err = statusEach(ctx, sender.Status, sentSmsIds); err.IsNotNil() {
+		return nil, err.
+			AddMessage(s).
+			Throw()
+	}
+
+	return resp, nil
+}
+
+// statusEach returns an info about many messages calling status for each ID.
+func statusEach(
+
+	ctx context.Context,
+	status StatusFunc,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	resp = make([]*StatusMessageResponse, len(sentSmsIds))
+	for i, sentSmsId := range sentSmsIds {
+		if resp[i], err = status(ctx, sentSmsId); err.IsNotNil() {
+			return nil, err.
+				WithString("sms_id", sentSmsId).
+				Throw()
+		}
+	}
+	return resp, nil
+}
+
+// statusBatchComposite is StatusBatch() for composite Senders, which IDs
+// are composed by ComposeMessageID(). IDs are grouped by the Senders
+// that have sent them. IDs that are not issued by composite Sender
+// are marked as not found.
+func statusBatchComposite(
+
+	ctx context.Context,
+	senders []Sender,
+	sentSmsIds []string,
+) (
+	resp []*StatusMessageResponse,
+	err *ekaerr.Error,
+) {
+	resp = make([]*StatusMessageResponse, len(sentSmsIds))
+	groups := make([][]int, len(senders))
+
+	for i, sentSmsId := range sentSmsIds {
+		idx, _, ok := ParseMessageID(sentSmsId)
+		if !ok || idx >= len(senders) {
+			resp[i] = &StatusMessageResponse{ID: sentSmsId, NotFound: true}
+			continue
+		}
+		groups[idx] = append(groups[idx], i)
+	}
+
+	for idx, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+
+		ids := make([]string, len(group))
+		for j, i := range group {
+			_, ids[j], _ = ParseMessageID(sentSmsIds[i])
+		}
+
+		var subResp []*StatusMessageResponse
+		if subResp, err = StatusBatch(ctx, senders[idx], ids); err.IsNotNil() {
+			return nil, err.
+				Throw()
+		}
+
+		for j, i := range group {
+			resp[i] = subResp[j]
+			resp[i].ID = sentSmsIds[i]
+		}
+	}
+
+	return resp, nil
+}
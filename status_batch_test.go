@@ -0,0 +1,61 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+)
+
+func TestStatusBatch(t *testing.T) {
+	q := smsenderu_mock.New()
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+
+	ids := append(resp.IDs, "unknown")
+	statuses, err := smsenderu.StatusBatch(context.Background(), q, ids)
+	require.True(t, err.IsNil())
+	require.Len(t, statuses, 3)
+	require.EqualValues(t, "79000000000", statuses[0].Recipient)
+	require.EqualValues(t, "79000000001", statuses[1].Recipient)
+	require.True(t, statuses[2].NotFound)
+}
+
+func TestStatusBatch_Failover(t *testing.T) {
+	primary := smsenderu_mock.New().
+		FailPhone("79000000001", smsenderu_mock.ERROR_CODE_NOT_ENOUGH_MONEY)
+	secondary := smsenderu_mock.New()
+
+	q := smsenderu.NewFailover(primary, secondary)
+
+	resp, err := q.Send(context.Background(), &smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001", "79000000002"},
+		Message:    "Code: 1234",
+	})
+	require.True(t, err.IsNil())
+
+	ids := append(resp.IDs, "not-composed", smsenderu.ComposeMessageID(5, "1"))
+	statuses, err := smsenderu.StatusBatch(context.Background(), q, ids)
+	require.True(t, err.IsNil())
+	require.Len(t, statuses, len(ids))
+
+	for i, phone := range []string{"79000000000", "79000000001", "79000000002"} {
+		require.EqualValues(t, ids[i], statuses[i].ID)
+		require.EqualValues(t, phone, statuses[i].Recipient)
+		require.False(t, statuses[i].NotFound)
+	}
+	require.True(t, statuses[3].NotFound)
+	require.True(t, statuses[4].NotFound)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+// Package smsenderu_translit transliterates Russian Cyrillic text to Latin
+// locally, using one of the standards, so the text the recipient gets
+// might be previewed and its segments might be counted before sending.
+//
+// Also some typographic characters, that are not in GSM-7 alphabet
+// («» — – № …), are replaced by their ASCII equivalents.
+package smsenderu_translit
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/segment"
+)
+
+type (
+	// Standard is a transliteration standard.
+	Standard uint8
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	// STANDARD_ICAO is ICAO Doc 9303 transliteration, the one that is used
+	// in Russian international passports since 2013 ("Щука" -> "Shchuka").
+	// It produces only Latin letters, so the text stays in GSM-7.
+	STANDARD_ICAO Standard = iota
+
+	// STANDARD_GOST_7_79_B is GOST 7.79-2000 (ISO 9:1995) system B,
+	// reversible transliteration using Latin letters and backticks
+	// ("Щука" -> "Shhuka", "объём" -> "ob``yom").
+	// Note: the backtick is not in GSM-7 alphabet and forces UCS-2.
+	STANDARD_GOST_7_79_B
+)
+
+var (
+	tableICAO = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+		'ж': "zh", 'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+		'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+		'ъ': "ie", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	}
+
+	tableGOST779B = map[rune]string{
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+		'ж': "zh", 'з': "z", 'и': "i", 'й': "j", 'к': "k", 'л': "l", 'м': "m",
+		'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "x", 'ц': "cz", 'ч': "ch", 'ш': "sh", 'щ': "shh",
+		'ъ': "``", 'ы': "y`", 'ь': "`", 'э': "e`", 'ю': "yu", 'я': "ya",
+	}
+
+	tableTypography = map[rune]string{
+		'«': "\"", '»': "\"", '„': "\"", '“': "\"", '”': "\"",
+		'‘': "'", '’': "'", '—': "-", '–': "-", '№': "N", '…': "...",
+		'\u00A0': " ",
+	}
+)
+
+// Transliterate returns text transliterated using standard.
+// Characters that are not Russian Cyrillic letters (and typographic characters)
+// are kept as is. Letter case is preserved: "Щука" -> "Shchuka", "ЩУКА" -> "SHCHUKA".
+func Transliterate(text string, standard Standard) string {
+
+	table := tableICAO
+	if standard == STANDARD_GOST_7_79_B {
+		table = tableGOST779B
+	}
+
+	runes := []rune(text)
+
+	var b strings.Builder
+	b.Grow(len(text))
+
+	for i, r := range runes {
+
+		if latin, ok := tableTypography[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+
+		lower := unicode.ToLower(r)
+		latin, ok := table[lower]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+
+		// GOST 7.79 B: "c" before "i", "e", "y", "j", "cz" elsewhere.
+		if standard == STANDARD_GOST_7_79_B && lower == 'ц' && i+1 < len(runes) {
+			if next := table[unicode.ToLower(runes[i+1])]; next != "" && strings.IndexByte("ieyj", next[0]) != -1 {
+				latin = "c"
+			}
+		}
+
+		if r != lower && latin != "" {
+			if isUpperWord(runes, i) {
+				latin = strings.ToUpper(latin)
+			} else {
+				first, size := utf8.DecodeRuneInString(latin)
+				latin = string(unicode.ToUpper(first)) + latin[size:]
+			}
+		}
+
+		b.WriteString(latin)
+	}
+
+	return b.String()
+}
+
+// Middleware returns smsenderu.Middleware that transliterates the message locally
+// using standard for Send() and Cost() requests with DoTransliterate flag,
+// and passes them further without that flag. Use it for providers that do not
+// support transliteration, or to get exactly the same text as Preview() returns.
+// The caller's request is not modified.
+func Middleware(standard Standard) smsenderu.Middleware {
+
+	transliterated := func(req *smsenderu.SendMessageRequest) *smsenderu.SendMessageRequest {
+		if req == nil || !req.DoTransliterate {
+			return req
+		}
+		reqCopy := *req
+		reqCopy.Message = Transliterate(req.Message, standard)
+		if len(req.Messages) > 0 {
+			reqCopy.Messages = make([]string, len(req.Messages))
+			for i, message := range req.Messages {
+				reqCopy.Messages[i] = Transliterate(message, standard)
+			}
+		}
+		reqCopy.DoTransliterate = false
+		return &reqCopy
+	}
+
+	return smsenderu.Middleware{
+		Send: func(next smsenderu.SendFunc) smsenderu.SendFunc {
+			return func(ctx context.Context, req *smsenderu.SendMessageRequest) (*smsenderu.SendMessageResponse, *ekaerr.Error) {
+				return next(ctx, transliterated(req))
+			}
+		},
+		Cost: func(next smsenderu.CostFunc) smsenderu.CostFunc {
+			return func(ctx context.Context, req *smsenderu.SendMessageRequest) (*smsenderu.CostSendMessageResponse, *ekaerr.Error) {
+				return next(ctx, transliterated(req))
+			}
+		},
+	}
+}
+
+// Preview returns text transliterated using standard
+// and an info about how it will be encoded and split into SMS.
+func Preview(text string, standard Standard) (string, smsenderu_segment.Info) {
+	transliterated := Transliterate(text, standard)
+	return transliterated, smsenderu_segment.Calculate(transliterated)
+}
+
+// isUpperWord reports whether the uppercase letter at i-th position
+// is a part of uppercase word (an abbreviation, a shout),
+// so its transliteration must be fully uppercase.
+func isUpperWord(runes []rune, i int) bool {
+	isUpperLetter := func(j int) bool {
+		return j >= 0 && j < len(runes) && unicode.IsLetter(runes[j]) && unicode.IsUpper(runes[j])
+	}
+	isLetter := func(j int) bool {
+		return j >= 0 && j < len(runes) && unicode.IsLetter(runes[j])
+	}
+	switch {
+	case isUpperLetter(i + 1):
+		return true
+	case isLetter(i + 1):
+		return false // Title case: "Щука"
+	default:
+		return isUpperLetter(i - 1) // the last letter of "ЩУКА"
+	}
+}
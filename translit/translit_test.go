@@ -0,0 +1,62 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_translit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/smsenderu"
+	"github.com/qioalice/smsenderu/mock"
+	"github.com/qioalice/smsenderu/segment"
+	"github.com/qioalice/smsenderu/translit"
+)
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		text     string
+		standard smsenderu_translit.Standard
+		expected string
+	}{
+		{"Щука", smsenderu_translit.STANDARD_ICAO, "Shchuka"},
+		{"ЩУКА", smsenderu_translit.STANDARD_ICAO, "SHCHUKA"},
+		{"Ваш код: 1234", smsenderu_translit.STANDARD_ICAO, "Vash kod: 1234"},
+		{"Юлия, объём — «ёлка»", smsenderu_translit.STANDARD_ICAO, "Iuliia, obieem - \"elka\""},
+		{"Щука", smsenderu_translit.STANDARD_GOST_7_79_B, "Shhuka"},
+		{"объём", smsenderu_translit.STANDARD_GOST_7_79_B, "ob``yom"},
+		{"цирк, кольцо", smsenderu_translit.STANDARD_GOST_7_79_B, "cirk, kol`czo"},
+		{"Hello, world!", smsenderu_translit.STANDARD_GOST_7_79_B, "Hello, world!"},
+	}
+	for _, test := range tests {
+		require.EqualValues(t, test.expected, smsenderu_translit.Transliterate(test.text, test.standard), test.text)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	text, info := smsenderu_translit.Preview("Ваш код: 1234", smsenderu_translit.STANDARD_ICAO)
+	require.EqualValues(t, "Vash kod: 1234", text)
+	require.EqualValues(t, smsenderu_segment.ENCODING_GSM7, info.Encoding)
+	require.EqualValues(t, 1, info.Segments)
+}
+
+func TestMiddleware(t *testing.T) {
+	sender := smsenderu_mock.New()
+	q := smsenderu.Chain(sender, smsenderu_translit.Middleware(smsenderu_translit.STANDARD_ICAO))
+
+	req := &smsenderu.SendMessageRequest{
+		Recipient:       "79000000000",
+		Message:         "Ваш код: 1234",
+		DoTransliterate: true,
+	}
+
+	_, err := q.Send(context.Background(), req)
+	require.True(t, err.IsNil())
+	require.EqualValues(t, "Ваш код: 1234", req.Message)
+	require.EqualValues(t, "Vash kod: 1234", sender.Sent()[0].Request.Message)
+	require.False(t, sender.Sent()[0].Request.DoTransliterate)
+}
@@ -0,0 +1,79 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	// Transport is an HTTP client that is used by Sender's implementations
+	// to perform outgoing API requests.
+	//
+	// The same Transport may be (and it's recommend to be) shared between
+	// many Senders, so they will use the same connection pool.
+	// Thus, Transport's implementations must be safe for concurrent use.
+	//
+	// Do must return an error only if request could not be performed
+	// (network failure, interrupted context, etc). HTTP status codes are not errors
+	// and must be returned as is, inside TransportResponse.
+	// If ctx is done, the returned error must be of Canceled or DeadlineExceeded class.
+	Transport interface {
+		Do(ctx context.Context, req *TransportRequest) (resp *TransportResponse, err *ekaerr.Error)
+	}
+
+	// TransportRequest represents an outgoing HTTP request.
+	TransportRequest struct {
+
+		// Method is an HTTP method. GET is used if it's empty.
+		Method string
+
+		// URL is an absolute URL of request. Query is added to it if presented.
+		URL   string
+		Query url.Values
+
+		// ContentType and Body are sent as is if Body is not empty.
+		ContentType string
+		Body        []byte
+	}
+
+	// TransportResponse represents an HTTP response of TransportRequest.
+	// Body is the copy of the response's body and may be retained by caller.
+	TransportResponse struct {
+		StatusCode int
+		Body       []byte
+	}
+)
+
+// fullURL returns TransportRequest's URL with encoded Query added.
+func (r *TransportRequest) fullURL() string {
+	if len(r.Query) == 0 {
+		return r.URL
+	}
+	return r.URL + "?" + r.Query.Encode()
+}
+
+// safeURL returns TransportRequest's URL without query, fragment and user info.
+// Only it can be attached to errors: the query of API request usually contains
+// an API token and a message text (e.g. one-time password).
+func (r *TransportRequest) safeURL() string {
+	u, legacyErr := url.Parse(r.URL)
+	if legacyErr != nil {
+		return "<malformed URL>"
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// method returns TransportRequest's HTTP method or GET if it's empty.
+func (r *TransportRequest) method() string {
+	if r.Method == "" {
+		return "GET"
+	}
+	return r.Method
+}
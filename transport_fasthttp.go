@@ -0,0 +1,174 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"context"
+	"time"
+
+	"github.com/valyala/fasthttp"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	transportFastHTTP struct {
+		fhc          *fasthttp.Client
+		maxRedirects int
+	}
+)
+
+// NewFastHTTPTransport returns a Transport that performs HTTP requests
+// using provided fasthttp.Client following up to maxRedirects HTTP redirects.
+// A new zero fasthttp.Client is used if client is nil.
+//
+// fasthttp does not support request cancellation, so if context might be canceled,
+// the request is performed in a separate goroutine that will be finished
+// by the fasthttp.Client's timeouts or context's deadline.
+func NewFastHTTPTransport(client *fasthttp.Client, maxRedirects int) Transport {
+	if client == nil {
+		client = new(fasthttp.Client)
+	}
+	if maxRedirects < 0 {
+		maxRedirects = 0
+	}
+	return &transportFastHTTP{fhc: client, maxRedirects: maxRedirects}
+}
+
+func (q *transportFastHTTP) Do(
+
+	ctx context.Context,
+	req *TransportRequest,
+) (
+	resp *TransportResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to perform remote HTTP request using fasthttp."
+
+	if err = ContextError(ctx, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	fhReq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(fhReq)
+	fhResp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(fhResp)
+
+	fhReq.Header.SetMethod(req.method())
+	fhReq.SetRequestURI(req.fullURL())
+
+	if len(req.Body) > 0 {
+		fhReq.Header.SetContentType(req.ContentType)
+		fhReq.SetBody(req.Body)
+	}
+
+	legacyErr := q.doContext(ctx, fhReq, fhResp)
+	if legacyErr != nil {
+		if err = WrapContextError(legacyErr, s); err.IsNotNil() {
+			return nil, err.
+				Throw()
+		}
+		return nil, ekaerr.ServiceUnavailable.Wrap(legacyErr, s).
+			WithString("url", req.safeURL()).
+			Throw()
+	}
+
+	resp = &TransportResponse{
+		StatusCode: fhResp.StatusCode(),
+		Body:       append([]byte(nil), fhResp.Body()...),
+	}
+
+	return resp, nil
+}
+
+// doContext performs HTTP request following redirects, waiting for either
+// the request is done or ctx is done. ctx's deadline is passed to fasthttp,
+// and its timeout error is reported as context.DeadlineExceeded.
+//
+// If ctx might be canceled, the request is performed in a separate goroutine
+// using its own copies of fhReq, fhResp, which will be released by that goroutine
+// even if ctx is done earlier than request is.
+func (q *transportFastHTTP) doContext(
+
+	ctx context.Context,
+	fhReq *fasthttp.Request,
+	fhResp *fasthttp.Response,
+) error {
+
+	deadline, hasDeadline := ctx.Deadline()
+	if ctx.Done() == nil {
+		return q.doRedirects(fhReq, fhResp, deadline)
+	}
+
+	fhReqCopy := fasthttp.AcquireRequest()
+	fhRespCopy := fasthttp.AcquireResponse()
+	fhReq.CopyTo(fhReqCopy)
+
+	release := func() {
+		fasthttp.ReleaseRequest(fhReqCopy)
+		fasthttp.ReleaseResponse(fhRespCopy)
+	}
+
+	chDone := make(chan error, 1)
+	go func() {
+		chDone <- q.doRedirects(fhReqCopy, fhRespCopy, deadline)
+	}()
+
+	select {
+
+	case legacyErr := <-chDone:
+		fhRespCopy.CopyTo(fhResp)
+		release()
+		if legacyErr == fasthttp.ErrTimeout && hasDeadline {
+			legacyErr = context.DeadlineExceeded
+		}
+		return legacyErr
+
+	case <-ctx.Done():
+		go func() {
+			<-chDone
+			release()
+		}()
+		return ctx.Err()
+	}
+}
+
+// doRedirects is the same as fasthttp.Client.DoRedirects() but respects
+// a deadline if it's not zero. Follows up to q.maxRedirects redirects.
+func (q *transportFastHTTP) doRedirects(
+
+	fhReq *fasthttp.Request,
+	fhResp *fasthttp.Response,
+	deadline time.Time,
+) error {
+
+	if deadline.IsZero() {
+		return q.fhc.DoRedirects(fhReq, fhResp, q.maxRedirects)
+	}
+
+	for redirects := 0; ; redirects++ {
+
+		if legacyErr := q.fhc.DoDeadline(fhReq, fhResp, deadline); legacyErr != nil {
+			return legacyErr
+		}
+
+		if !fasthttp.StatusCodeIsRedirect(fhResp.StatusCode()) {
+			return nil
+		}
+
+		if redirects == q.maxRedirects {
+			return fasthttp.ErrTooManyRedirects
+		}
+
+		location := fhResp.Header.Peek(fasthttp.HeaderLocation)
+		if len(location) == 0 {
+			return fasthttp.ErrMissingLocation
+		}
+
+		fhReq.URI().UpdateBytes(location)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+type (
+	transportNetHTTP struct {
+		hc *http.Client
+	}
+)
+
+// NewNetHTTPTransport returns a Transport that performs HTTP requests
+// using provided net/http's http.Client. http.DefaultClient is used if client is nil.
+//
+// It allows to reuse proxies, TLS client certificates and http.RoundTripper
+// middlewares you already have. Redirects are followed according to
+// the client's CheckRedirect policy.
+func NewNetHTTPTransport(client *http.Client) Transport {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &transportNetHTTP{hc: client}
+}
+
+func (q *transportNetHTTP) Do(
+
+	ctx context.Context,
+	req *TransportRequest,
+) (
+	resp *TransportResponse,
+	err *ekaerr.Error,
+) {
+	const s = "Failed to perform remote HTTP request using net/http."
+
+	if err = ContextError(ctx, s); err.IsNotNil() {
+		return nil, err.
+			Throw()
+	}
+
+	var body io.Reader
+	if len(req.Body) > 0 {
+		body = bytes.NewReader(req.Body)
+	}
+
+	httpReq, legacyErr := http.NewRequestWithContext(ctx, req.method(), req.fullURL(), body)
+	if legacyErr != nil {
+		return nil, ekaerr.IllegalArgument.Wrap(unwrapURLError(legacyErr), s).
+			WithString("url", req.safeURL()).
+			Throw()
+	}
+
+	if body != nil {
+		httpReq.Header.Set("Content-Type", req.ContentType)
+	}
+
+	httpResp, legacyErr := q.hc.Do(httpReq)
+	if legacyErr != nil {
+		if err = ContextError(ctx, s); err.IsNotNil() {
+			return nil, err.
+				Throw()
+		}
+		return nil, ekaerr.ServiceUnavailable.Wrap(unwrapURLError(legacyErr), s).
+			WithString("url", req.safeURL()).
+			Throw()
+	}
+	defer httpResp.Body.Close()
+
+	respBody, legacyErr := ioutil.ReadAll(httpResp.Body)
+	if legacyErr != nil {
+		if err = ContextError(ctx, s); err.IsNotNil() {
+			return nil, err.
+				Throw()
+		}
+		return nil, ekaerr.ServiceUnavailable.Wrap(legacyErr, s).
+			WithString("description", "Failed to read HTTP response body.").
+			WithString("url", req.safeURL()).
+			Throw()
+	}
+
+	resp = &TransportResponse{
+		StatusCode: httpResp.StatusCode,
+		Body:       respBody,
+	}
+
+	return resp, nil
+}
+
+// unwrapURLError returns the cause of *url.Error, since its message contains
+// the full URL of request with the API token and message text in the query.
+func unwrapURLError(legacyErr error) error {
+	if urlErr, ok := legacyErr.(*url.Error); ok {
+		return urlErr.Err
+	}
+	return legacyErr
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/shopspring/decimal"
 
+	"github.com/qioalice/ekago/v3/ekaerr"
 	"github.com/qioalice/ekago/v3/ekatime"
 )
 
@@ -37,6 +38,15 @@ type (
 		// Must be UTF-8 encoded.
 		Message string
 
+		// Messages are the personalized messages: i-th recipient gets i-th message.
+		// If presented, it must have the same length as recipients
+		// and Message is ignored. Must be UTF-8 encoded.
+		//
+		// Providers that have a native form of such request send them at once,
+		// others send a message to each recipient separately (see SendEach()).
+		// Either way, SendMessageResponse is the same as for Message.
+		Messages []string
+
 		// From is a sender. A name that is shown to user when their receive
 		// a message.
 		//
@@ -73,8 +83,9 @@ type (
 		// SendAt allows you to defer the sending of message.
 		// The message will be sent (NOT DELIVERED!) at the specified time.
 		//
-		// The value is ignored (and overwritten by 0) if less than now,
-		// and it's not possible to specify a date more than 2 months from today.
+		// The value is ignored if less than now (the request is not changed),
+		// and providers limit how far the sending may be deferred to
+		// (see SendAtWithin() rule of Validate()).
 		// Otherwise it's UB - fast error, service error.
 		// Depends on provider's and implementation.
 		//
@@ -89,7 +100,8 @@ type (
 		// If that time interval will pass and message still is not delivered,
 		// it will be rejected and never delivered anymore.
 		//
-		// If specified, must be in the range [1m..24h].
+		// Zero TTL means it's not specified.
+		// If specified, must be in the range [1m..24h] (see TTLWithin() rule of Validate()).
 		// Otherwise it's UB - fast error, service error.
 		// Depends on provider's and implementation.
 		//
@@ -101,6 +113,23 @@ type (
 		EnableUserLocation bool
 		DoTransliterate    bool
 
+		// IsPing makes the request a ping-SMS: an invisible (class 0, "silent")
+		// message, that is not shown to the recipient, but its delivery status
+		// tells whether the phone is reachable right now.
+		// Message is not required and ignored.
+		//
+		// IsHLR makes the request an HLR lookup: no message is sent at all,
+		// but the recipient's mobile network is asked about the phone number's
+		// state (see HLRResult). Message is not required and ignored.
+		//
+		// Only one of them might be set.
+		// The results are reported by Sender.Status() (StatusMessageResponse.HLR).
+		//
+		// WARNING!
+		// May not be supported by specified API provider,
+		// in which case an error of ekaerr.UnsupportedOperation class is returned
+		// and nothing is sent.
+		// Read the provider's docs.
 		IsPing bool
 		IsHLR  bool
 	}
@@ -119,18 +148,62 @@ type (
 	// then its associated id (in IDs) will be an empty string, but error code from
 	// ErrorCodes.
 	//
+	// SendMessageResponse may be returned along with an error of PartialFailure class
+	// if the message has been sent by several API requests and some of them
+	// have failed. Check the response in that case, not only the error.
+	//
+	// Results has the same length and order as IDs and ErrorCodes
+	// and contains the detailed result of sending message to each phone number.
+	// Balance is the account's balance after sending (in the currency
+	// Sender.Balance() reports).
+	//
 	// WARNING!
 	// Error codes are depended on API provider
 	// and may be different for the different providers (even if they means the same).
+	// Results is nil and Balance is nil if the provider doesn't report them.
 	SendMessageResponse struct {
 		IDs        []string
 		ErrorCodes []int
+
+		Results []SendMessageResult
+		Balance *decimal.Decimal
+	}
+
+	// SendMessageResult is the result of sending message to one phone number.
+	// ID and ErrorCode are the same as in SendMessageResponse's IDs and ErrorCodes.
+	// Cost and Segments are zero if the message has not been sent
+	// or the provider doesn't report them.
+	SendMessageResult struct {
+		// Phone is the phone number in the form the provider has normalized it to.
+		Phone string
+
+		ID        string
+		ErrorCode int
+
+		// StatusText is the human readable meaning of ErrorCode
+		// or an empty string if provider has no one.
+		StatusText string
+
+		Cost     decimal.Decimal
+		Segments int
+
+		// Err is the cause the message has not been sent
+		// if ErrorCode is ERROR_CODE_NOT_SENT, nil otherwise.
+		Err *ekaerr.Error
 	}
 
 	StatusMessageResponse struct {
 		ID        string
 		ErrorCode int
 
+		// NotFound is true if provider doesn't know a message with such ID.
+		// ErrorCode contains the provider's own code of that case.
+		NotFound bool
+
+		// StatusText is a human readable meaning of ErrorCode,
+		// if provider reports it.
+		StatusText string
+
 		Recipient string
 		Message   string
 		From      string
@@ -142,7 +215,36 @@ type (
 		Region   string
 		Operator string
 
-		// TODO: HLR fields as a separate embedded (pointer based) type
+		// HLR is the result of HLR lookup or ping-SMS
+		// (see SendMessageRequest.IsHLR, SendMessageRequest.IsPing).
+		// Nil for the regular messages and while the result is not ready yet.
+		HLR *HLRResult
+	}
+
+	// HLRResult is the state of the phone number in the mobile network,
+	// reported by HLR (Home Location Register) lookup.
+	// Ping-SMS reports only Reachable.
+	HLRResult struct {
+
+		// Reachable is true if the phone is registered in the network
+		// (turned on and is in the coverage area) right now.
+		Reachable bool
+
+		// Roaming is true if the phone is served by a network
+		// other than its home one right now.
+		Roaming bool
+
+		// Ported is true if the phone number has been ported
+		// to other operator (MNP), so HomeOperator is not the one
+		// the number range is assigned to.
+		Ported bool
+
+		// HomeOperator is the operator the phone number belongs to.
+		HomeOperator string
+
+		// CurrentOperator is the operator that serves the phone right now.
+		// It's different from HomeOperator when the phone is in roaming.
+		CurrentOperator string
 	}
 
 	// CostSendMessageResponse is a response of the calling Sender.Cost().
@@ -150,11 +252,56 @@ type (
 	// as SendMessageRequest's); Total must have the total cost of sending message
 	// to all recipients.
 	//
+	// Segments is the number of SMS the message is split into per i-th phone number
+	// (in the same order), TotalSegments is their sum.
+	//
 	// WARNING!
 	// May not be supported by specified API provider.
 	// Read the provider's docs.
+	// Costs and Segments are nil if the provider doesn't report them per recipient.
+	//
+	// ErrorCodes has the same order and contains the provider's error codes
+	// of recipients the cost is not calculated for (e.g. of invalid phone numbers),
+	// their Costs and Segments are zero. Zero code (or nil ErrorCodes) means
+	// the cost is calculated.
 	CostSendMessageResponse struct {
 		Costs []decimal.Decimal
 		Total decimal.Decimal
+
+		Segments      []int
+		TotalSegments int
+
+		ErrorCodes []int
 	}
 )
+
+// AllRecipients returns the recipients of SendMessageRequest as a slice
+// regardless of whether Recipient or Recipients is used.
+// If there are no recipients (or the request is nil), the request is invalid,
+// and composite Senders pass it to their (first) Sender as is,
+// to let it report about it in its own way.
+func (q *SendMessageRequest) AllRecipients() []string {
+	switch {
+	case q == nil:
+		return nil
+	case q.Recipient != "":
+		return []string{q.Recipient}
+	default:
+		return q.Recipients
+	}
+}
+
+// AllMessages returns the message each recipient of SendMessageRequest gets,
+// in the same order as AllRecipients() returns them: the personalized one
+// of Messages or Message if there is no such one.
+func (q *SendMessageRequest) AllMessages() []string {
+	messages := make([]string, len(q.AllRecipients()))
+	for i := range messages {
+		if i < len(q.Messages) {
+			messages[i] = q.Messages[i]
+		} else {
+			messages[i] = q.Message
+		}
+	}
+	return messages
+}
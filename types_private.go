@@ -0,0 +1,186 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/qioalice/ekago/v3/ekaerr"
+)
+
+// isSendResponseValid reports whether SendMessageResponse follows the contract
+// of IDs and ErrorCodes lengths for the request with n recipients.
+func isSendResponseValid(resp *SendMessageResponse, n int) bool {
+	return resp != nil && len(resp.IDs) == n && len(resp.ErrorCodes) == n
+}
+
+// isPartialFailure reports whether err is an error of PartialFailure class
+// returned along with SendMessageResponse for n recipients,
+// so the response must be used.
+func isPartialFailure(resp *SendMessageResponse, err *ekaerr.Error, n int) bool {
+	return err.Is(PartialFailure) && isSendResponseValid(resp, n)
+}
+
+// nonNilSenders returns senders without nil ones.
+func nonNilSenders(senders []Sender) []Sender {
+	filtered := make([]Sender, 0, len(senders))
+	for _, sender := range senders {
+		if sender != nil {
+			filtered = append(filtered, sender)
+		}
+	}
+	return filtered
+}
+
+// subRequest returns a copy of SendMessageRequest that has only the recipients
+// (and their personalized messages) with provided indexes.
+func subRequest(req *SendMessageRequest, recipients []string, indexes []int) *SendMessageRequest {
+
+	subReq := *req
+	subReq.Recipient = ""
+	subReq.Recipients = make([]string, len(indexes))
+	for j, i := range indexes {
+		subReq.Recipients[j] = recipients[i]
+	}
+
+	// Messages of invalid length are kept as is.
+	if len(req.Messages) == len(recipients) {
+		subReq.Messages = make([]string, len(indexes))
+		for j, i := range indexes {
+			subReq.Messages[j] = req.Messages[i]
+		}
+	}
+
+	return &subReq
+}
+
+// newSendResponse returns SendMessageResponse for n recipients
+// the responses for their parts are merged to by mergeSendResponse().
+func newSendResponse(n int) *SendMessageResponse {
+	return &SendMessageResponse{
+		IDs:        make([]string, n),
+		ErrorCodes: make([]int, n),
+		Results:    make([]SendMessageResult, n),
+	}
+}
+
+// mergeSendResponse merges subResp, the response for the recipients
+// with provided indexes, to resp. Each ID is converted by composeID if it's not nil.
+// Results of resp become nil if subResp has no them.
+// Balance of resp becomes the lowest of reported ones,
+// it's the balance after the last of sendings of the same Sender.
+func mergeSendResponse(
+
+	resp, subResp *SendMessageResponse,
+	indexes []int,
+	composeID func(id string) string,
+) {
+	if resp.Results != nil && len(subResp.Results) != len(indexes) {
+		resp.Results = nil
+	}
+
+	for j, i := range indexes {
+		resp.IDs[i], resp.ErrorCodes[i] = subResp.IDs[j], subResp.ErrorCodes[j]
+		if resp.IDs[i] != "" && composeID != nil {
+			resp.IDs[i] = composeID(resp.IDs[i])
+		}
+		if resp.Results != nil {
+			resp.Results[i] = subResp.Results[j]
+			resp.Results[i].ID = resp.IDs[i]
+		}
+	}
+
+	if subResp.Balance != nil && (resp.Balance == nil || subResp.Balance.LessThan(*resp.Balance)) {
+		balance := *subResp.Balance
+		resp.Balance = &balance
+	}
+}
+
+// resetMergedBalance resets the balance of resp, that is merged
+// from the responses of nSenders different Senders, if there are many of them.
+// The balances of different Senders are not comparable.
+func resetMergedBalance(resp *SendMessageResponse, nSenders int) {
+	if nSenders > 1 {
+		resp.Balance = nil
+	}
+}
+
+// failSendResponse marks the recipients with provided indexes in resp
+// as the ones the message has not been sent to because of err.
+// recipients[j] is the phone number of indexes[j] recipient.
+func failSendResponse(
+
+	resp *SendMessageResponse,
+	recipients []string,
+	indexes []int,
+	err *ekaerr.Error,
+) {
+	for j, i := range indexes {
+		resp.IDs[i], resp.ErrorCodes[i] = "", ERROR_CODE_NOT_SENT
+		if resp.Results != nil {
+			resp.Results[i] = SendMessageResult{
+				Phone:      recipients[j],
+				ErrorCode:  ERROR_CODE_NOT_SENT,
+				StatusText: "Message has not been sent, API request has failed.",
+				Err:        err,
+			}
+		}
+	}
+}
+
+// countNotSent returns the number of recipients with ERROR_CODE_NOT_SENT
+// error code in SendMessageResponse.
+func countNotSent(resp *SendMessageResponse) int {
+	n := 0
+	for _, code := range resp.ErrorCodes {
+		if code == ERROR_CODE_NOT_SENT {
+			n++
+		}
+	}
+	return n
+}
+
+// newCostResponse returns CostSendMessageResponse for n recipients
+// the responses for their parts are merged to by mergeCostResponse().
+func newCostResponse(n int) *CostSendMessageResponse {
+	return &CostSendMessageResponse{
+		Costs:      make([]decimal.Decimal, n),
+		Total:      decimal.Zero,
+		Segments:   make([]int, n),
+		ErrorCodes: make([]int, n),
+	}
+}
+
+// mergeCostResponse merges subResp, the response for the recipients
+// with provided indexes, to resp. Costs (Segments) of resp become nil
+// if subResp has no them. ErrorCodes are copied if subResp has them.
+func mergeCostResponse(resp, subResp *CostSendMessageResponse, indexes []int) {
+
+	resp.Total = resp.Total.Add(subResp.Total)
+	resp.TotalSegments += subResp.TotalSegments
+
+	if resp.Costs != nil && len(subResp.Costs) == len(indexes) {
+		for j, i := range indexes {
+			resp.Costs[i] = subResp.Costs[j]
+		}
+	} else {
+		resp.Costs = nil
+	}
+
+	if resp.Segments != nil && len(subResp.Segments) == len(indexes) {
+		for j, i := range indexes {
+			resp.Segments[i] = subResp.Segments[j]
+		}
+	} else {
+		resp.Segments = nil
+	}
+
+	if len(subResp.ErrorCodes) == len(indexes) {
+		for j, i := range indexes {
+			resp.ErrorCodes[i] = subResp.ErrorCodes[j]
+		}
+	}
+}
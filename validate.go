@@ -0,0 +1,167 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qioalice/ekago/v3/ekatime"
+)
+
+type (
+	// FieldRule is the name of the rule a field of SendMessageRequest violates.
+	FieldRule string
+
+	// FieldError is a violation of some rule by a field of SendMessageRequest.
+	// Field is the name of the field, with the index for the slice's item,
+	// like "Recipients[2]". Value is the value of the field that violates the rule.
+	FieldError struct {
+		Field string
+		Rule  FieldRule
+		Value interface{}
+	}
+
+	// ValidationErrors are all violations of the rules by SendMessageRequest.
+	ValidationErrors []FieldError
+
+	// ValidationRule is a rule of SendMessageRequest a provider may add
+	// to the common ones. It returns the violations of the rule if any.
+	ValidationRule func(req *SendMessageRequest) []FieldError
+)
+
+//goland:noinspection GoSnakeCaseUsage
+const (
+	FIELD_RULE_REQUIRED FieldRule = "required"
+	FIELD_RULE_LENGTH   FieldRule = "length"
+	FIELD_RULE_RANGE    FieldRule = "range"
+	FIELD_RULE_MAX      FieldRule = "max"
+	FIELD_RULE_CONFLICT FieldRule = "conflict"
+)
+
+// Validate checks SendMessageRequest by the common rules and provided rules
+// and returns all violations of them, or nil if request is valid.
+//
+// The common rules: request is not nil; there is at least one recipient
+// and no one of them is empty; Message is not empty unless Messages,
+// IsPing or IsHLR is used; Messages (if used) has the same length as recipients
+// and no empty message; IsPing and IsHLR are not used together;
+// TTL is not negative (zero TTL means it's not specified).
+//
+// Provider specific rules are passed by Sender implementations,
+// see MaxRecipients(), SendAtWithin(), TTLWithin().
+func Validate(req *SendMessageRequest, rules ...ValidationRule) ValidationErrors {
+
+	if req == nil {
+		return ValidationErrors{{Field: "SendMessageRequest", Rule: FIELD_RULE_REQUIRED}}
+	}
+
+	var errs ValidationErrors
+	recipients := req.AllRecipients()
+
+	if len(recipients) == 0 {
+		errs = append(errs, FieldError{Field: "Recipients", Rule: FIELD_RULE_REQUIRED})
+	}
+	if req.Recipient == "" {
+		for i, recipient := range req.Recipients {
+			if recipient == "" {
+				errs = append(errs, FieldError{Field: indexedField("Recipients", i), Rule: FIELD_RULE_REQUIRED, Value: recipient})
+			}
+		}
+	}
+
+	switch {
+	case len(req.Messages) > 0 && len(req.Messages) != len(recipients):
+		errs = append(errs, FieldError{Field: "Messages", Rule: FIELD_RULE_LENGTH, Value: len(req.Messages)})
+	case len(req.Messages) > 0:
+		for i, message := range req.Messages {
+			if message == "" {
+				errs = append(errs, FieldError{Field: indexedField("Messages", i), Rule: FIELD_RULE_REQUIRED, Value: message})
+			}
+		}
+	case req.Message == "" && !req.IsPing && !req.IsHLR:
+		errs = append(errs, FieldError{Field: "Message", Rule: FIELD_RULE_REQUIRED, Value: req.Message})
+	}
+
+	if req.IsPing && req.IsHLR {
+		errs = append(errs, FieldError{Field: "IsHLR", Rule: FIELD_RULE_CONFLICT, Value: req.IsHLR})
+	}
+
+	if req.TTL < 0 {
+		errs = append(errs, FieldError{Field: "TTL", Rule: FIELD_RULE_RANGE, Value: req.TTL})
+	}
+
+	for _, rule := range rules {
+		if rule != nil {
+			errs = append(errs, rule(req)...)
+		}
+	}
+
+	return errs
+}
+
+// MaxRecipients returns a ValidationRule that limits the number of recipients.
+func MaxRecipients(n int) ValidationRule {
+	return func(req *SendMessageRequest) []FieldError {
+		if recipients := req.AllRecipients(); len(recipients) > n {
+			return []FieldError{{Field: "Recipients", Rule: FIELD_RULE_MAX, Value: len(recipients)}}
+		}
+		return nil
+	}
+}
+
+// SendAtWithin returns a ValidationRule that limits how far
+// the sending may be deferred to, starting from now. Zero SendAt is allowed.
+func SendAtWithin(d time.Duration) ValidationRule {
+	return func(req *SendMessageRequest) []FieldError {
+		if req.SendAt != 0 && req.SendAt > ekatime.OnceInMinute.Now()+ekatime.Timestamp(d/time.Second) {
+			return []FieldError{{Field: "SendAt", Rule: FIELD_RULE_RANGE, Value: req.SendAt}}
+		}
+		return nil
+	}
+}
+
+// TTLWithin returns a ValidationRule that requires TTL to be in the range [min..max].
+// Zero TTL is allowed (it's not specified then).
+func TTLWithin(min, max time.Duration) ValidationRule {
+	return func(req *SendMessageRequest) []FieldError {
+		if req.TTL != 0 && (req.TTL < min || req.TTL > max) {
+			return []FieldError{{Field: "TTL", Rule: FIELD_RULE_RANGE, Value: req.TTL}}
+		}
+		return nil
+	}
+}
+
+// String returns the violation in the form "Field: rule (value)".
+func (q FieldError) String() string {
+	return fmt.Sprintf("%s: %s (%v)", q.Field, q.Rule, q.Value)
+}
+
+// String returns all violations separated by "; ".
+func (q ValidationErrors) String() string {
+	ss := make([]string, len(q))
+	for i := range q {
+		ss[i] = q[i].String()
+	}
+	return strings.Join(ss, "; ")
+}
+
+// Has reports whether there is a violation of the rule by the field.
+func (q ValidationErrors) Has(field string, rule FieldRule) bool {
+	for i := range q {
+		if q[i].Field == field && q[i].Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// indexedField returns the name of i-th item of the slice field.
+func indexedField(field string, i int) string {
+	return field + "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,73 @@
+// Copyright © 2020. All rights reserved.
+// Author: Ilya Stroy.
+// Contacts: iyuryevich@pm.me, https://github.com/qioalice
+// License: https://opensource.org/licenses/MIT
+
+package smsenderu_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/qioalice/ekago/v3/ekatime"
+
+	"github.com/qioalice/smsenderu"
+)
+
+func TestValidate(t *testing.T) {
+	require.Nil(t, smsenderu.Validate(&smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+	}), "Zero TTL and SendAt must be allowed")
+
+	errs := smsenderu.Validate(&smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "", "79000000002"},
+		Messages:   []string{"Code: 1234", "", "Code: 5678"},
+		IsPing:     true,
+		IsHLR:      true,
+		TTL:        -time.Minute,
+	})
+	require.Len(t, errs, 4, errs.String())
+	require.True(t, errs.Has("Recipients[1]", smsenderu.FIELD_RULE_REQUIRED))
+	require.True(t, errs.Has("Messages[1]", smsenderu.FIELD_RULE_REQUIRED))
+	require.True(t, errs.Has("IsHLR", smsenderu.FIELD_RULE_CONFLICT))
+	require.True(t, errs.Has("TTL", smsenderu.FIELD_RULE_RANGE))
+	require.EqualValues(t, -time.Minute, errs[3].Value)
+
+	errs = smsenderu.Validate(&smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Messages:   []string{"Code: 1234"},
+	})
+	require.True(t, errs.Has("Messages", smsenderu.FIELD_RULE_LENGTH))
+
+	errs = smsenderu.Validate(nil)
+	require.True(t, errs.Has("SendMessageRequest", smsenderu.FIELD_RULE_REQUIRED))
+}
+
+func TestValidate_Rules(t *testing.T) {
+	rules := []smsenderu.ValidationRule{
+		smsenderu.MaxRecipients(1),
+		smsenderu.SendAtWithin(24 * time.Hour),
+		smsenderu.TTLWithin(time.Minute, time.Hour),
+	}
+
+	errs := smsenderu.Validate(&smsenderu.SendMessageRequest{
+		Recipients: []string{"79000000000", "79000000001"},
+		Message:    "Code: 1234",
+		SendAt:     ekatime.NewTimestampNow() + 2*ekatime.SECONDS_IN_DAY,
+		TTL:        2 * time.Hour,
+	}, rules...)
+	require.Len(t, errs, 3, errs.String())
+	require.True(t, errs.Has("Recipients", smsenderu.FIELD_RULE_MAX))
+	require.True(t, errs.Has("SendAt", smsenderu.FIELD_RULE_RANGE))
+	require.True(t, errs.Has("TTL", smsenderu.FIELD_RULE_RANGE))
+
+	require.Nil(t, smsenderu.Validate(&smsenderu.SendMessageRequest{
+		Recipient: "79000000000",
+		Message:   "Code: 1234",
+		SendAt:    ekatime.NewTimestampNow() + ekatime.SECONDS_IN_HOUR,
+		TTL:       time.Minute,
+	}, rules...))
+}